@@ -0,0 +1,130 @@
+// MIT License
+//
+// Copyright (c) 2024 yulog
+
+package favicon
+
+import (
+	"context"
+	"sort"
+)
+
+// Best returns the Icon that best fits a square of target×target pixels,
+// or nil if icons is empty. Icons are ranked as by SortByClosestTo:
+//
+//  1. The smallest icon at least as large as the target. Scalable icons
+//     count as larger than any other.
+//  2. Otherwise, the largest icon smaller than the target.
+//  3. Otherwise, an icon of unknown size, e.g. /favicon.ico.
+//  4. Otherwise, a mask icon (see Icon.Mask).
+//  5. Otherwise, a logo or social image (see KindLogo and
+//     KindSocialImage).
+//
+// Icons of equal size are ranked by format (PNG > JPEG > SVG > ICO).
+func Best(icons []*Icon, target int) *Icon {
+	if len(icons) == 0 {
+		return nil
+	}
+	v := ByClosestTo{Icons: append([]*Icon(nil), icons...), Width: target, Height: target}
+	sort.Sort(v)
+	return v.Icons[0]
+}
+
+// FindBest finds the icon for URL that best fits a square of target×target
+// pixels. It returns nil if no icon is found. See Best().
+func FindBest(url string, target int) (*Icon, error) { return finder.FindBest(url, target) }
+
+// FindBestContext finds the icon for URL that best fits a square of
+// target×target pixels. See Best().
+func FindBestContext(ctx context.Context, url string, target int) (*Icon, error) {
+	return finder.FindBestContext(ctx, url, target)
+}
+
+// FindBest finds the icon for URL that best fits a square of target×target
+// pixels. It returns nil if no icon is found. See Best().
+func (f *Finder) FindBest(url string, target int) (*Icon, error) {
+	return f.FindBestContext(context.Background(), url, target)
+}
+
+// FindBestContext finds the icon for URL that best fits a square of
+// target×target pixels. See Best().
+func (f *Finder) FindBestContext(ctx context.Context, url string, target int) (*Icon, error) {
+	icons, err := f.FindContext(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return Best(icons, target), nil
+}
+
+// SortByClosestTo sorts icons by how well they fit the given size, using
+// the same ranking as Best().
+func SortByClosestTo(width, height int) Option {
+	return WithSorter(func(icons []*Icon) sort.Interface {
+		return ByClosestTo{Icons: icons, Width: width, Height: height}
+	})
+}
+
+// ByClosestTo sorts icons by how well they fit Width×Height. Icons at least
+// as large come first (smallest first), then smaller icons (largest first),
+// then icons of unknown size, then masks, then logos and social images.
+// Icons of equal size are sorted by image type (PNG > JPEG > SVG > ICO).
+type ByClosestTo struct {
+	Icons         []*Icon
+	Width, Height int
+}
+
+// Implement sort.Interface
+func (v ByClosestTo) Len() int      { return len(v.Icons) }
+func (v ByClosestTo) Swap(i, j int) { v.Icons[i], v.Icons[j] = v.Icons[j], v.Icons[i] }
+
+func (v ByClosestTo) Less(i, j int) bool {
+	a, b := v.Icons[i], v.Icons[j]
+	if ga, gb := sortGroup(a), sortGroup(b); ga != gb {
+		return ga < gb
+	}
+	ca, cb := v.class(a), v.class(b)
+	if ca != cb {
+		return ca < cb
+	}
+
+	switch ca {
+	case fitLarger:
+		// scalable icons are larger than all others
+		if a.Scalable != b.Scalable {
+			return b.Scalable
+		}
+		if aa, ab := a.Width*a.Height, b.Width*b.Height; aa != ab {
+			return aa < ab
+		}
+	case fitSmaller:
+		if aa, ab := a.Width*a.Height, b.Width*b.Height; aa != ab {
+			return aa > ab
+		}
+	}
+
+	fa, fb := formatRank[a.MimeType], formatRank[b.MimeType]
+	if fa != fb {
+		return fa > fb
+	}
+	return a.URL < b.URL
+}
+
+// how an icon fits the target size, in order of preference
+const (
+	fitLarger  = iota // at least as large as target
+	fitSmaller        // smaller than target
+	fitUnknown        // size unknown
+)
+
+func (v ByClosestTo) class(icon *Icon) int {
+	switch {
+	case icon.Scalable:
+		return fitLarger
+	case icon.Width == 0 || icon.Height == 0:
+		return fitUnknown
+	case icon.Width >= v.Width && icon.Height >= v.Height:
+		return fitLarger
+	default:
+		return fitSmaller
+	}
+}
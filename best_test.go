@@ -0,0 +1,85 @@
+// MIT License
+//
+// Copyright (c) 2024 yulog
+
+package favicon
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBest verifies selection of the best icon for a target size.
+func TestBest(t *testing.T) {
+	t.Parallel()
+	var (
+		ico     = &Icon{URL: "/favicon.ico", MimeType: "image/x-icon"}
+		png16   = &Icon{URL: "/16.png", MimeType: "image/png", Width: 16, Height: 16}
+		ico32   = &Icon{URL: "/32.ico", MimeType: "image/x-icon", Width: 32, Height: 32}
+		png32   = &Icon{URL: "/32.png", MimeType: "image/png", Width: 32, Height: 32}
+		png180  = &Icon{URL: "/180.png", MimeType: "image/png", Width: 180, Height: 180}
+		jpeg180 = &Icon{URL: "/180.jpg", MimeType: "image/jpeg", Width: 180, Height: 180}
+		png512  = &Icon{URL: "/512.png", MimeType: "image/png", Width: 512, Height: 512}
+		wide    = &Icon{URL: "/wide.png", MimeType: "image/png", Width: 128, Height: 32}
+		svg     = &Icon{URL: "/icon.svg", MimeType: "image/svg+xml", Scalable: true}
+	)
+	tests := []struct {
+		name   string
+		icons  []*Icon
+		target int
+		x      *Icon
+	}{
+		{"empty", nil, 64, nil},
+		{"smallest-larger", []*Icon{png16, png512, png180, png32}, 64, png180},
+		{"exact", []*Icon{png16, png512, png32}, 32, png32},
+		{"largest-smaller", []*Icon{png16, png32, ico}, 64, png32},
+		{"prefer-png", []*Icon{jpeg180, png180}, 64, png180},
+		{"prefer-png-over-ico", []*Icon{ico32, png32}, 32, png32},
+		{"unknown-size", []*Icon{ico}, 64, ico},
+		{"not-tall-enough", []*Icon{wide, png32}, 64, wide},
+		{"raster-over-scalable", []*Icon{svg, png512}, 64, png512},
+		{"scalable-over-smaller", []*Icon{svg, png32, ico}, 64, svg},
+	}
+
+	for _, td := range tests {
+		td := td
+		t.Run(td.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, td.x, Best(td.icons, td.target), "unexpected icon")
+		})
+	}
+
+	icons := []*Icon{ico, png16, png512, svg, png32, jpeg180, png180}
+	sort.Sort(ByClosestTo{Icons: icons, Width: 64, Height: 64})
+	assert.Equal(t, []*Icon{png180, jpeg180, png512, svg, png32, png16, ico}, icons, "unexpected order")
+}
+
+// TestFindBest verifies Finder.FindBest.
+func TestFindBest(t *testing.T) {
+	t.Parallel()
+	ts := httptest.NewServer(http.FileServer(http.Dir("./testdata/kuli")))
+	defer ts.Close()
+
+	f := New(WithClient(ts.Client()), WithLogger(debugLogger{}), IgnoreManifest, IgnoreWellKnown)
+	icon, err := f.FindBest(ts.URL+"/index.html", 64)
+	require.Nil(t, err, "unexpected error")
+	require.NotNil(t, icon, "no icon found")
+	assert.Equal(t, 180, icon.Width, "unexpected width")
+
+	f = New(WithClient(ts.Client()), WithLogger(debugLogger{}), IgnoreManifest, IgnoreWellKnown, OnlyMimeType("image/gif"))
+	icon, err = f.FindBest(ts.URL+"/index.html", 64)
+	require.Nil(t, err, "unexpected error")
+	assert.Nil(t, icon, "unexpected icon")
+
+	// sorter
+	f = New(WithClient(ts.Client()), WithLogger(debugLogger{}), IgnoreManifest, IgnoreWellKnown, SortByClosestTo(64, 64))
+	icons, err := f.Find(ts.URL + "/index.html")
+	require.Nil(t, err, "unexpected error")
+	require.Greater(t, len(icons), 1, "too few icons found")
+	assert.Equal(t, 180, icons[0].Width, "unexpected width")
+}
@@ -0,0 +1,297 @@
+// MIT License
+//
+// Copyright (c) 2024 yulog
+
+package favicon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	urls "net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cache stores search results and HTTP responses retrieved by a Finder.
+// Implementations must be safe for concurrent use. Pass a Cache to
+// WithCache().
+type Cache interface {
+	// Get returns the value stored under key, or false if there is no
+	// value or it has expired.
+	Get(key string) ([]byte, bool)
+	// Set stores value under key for the given duration.
+	Set(key string, value []byte, ttl time.Duration)
+}
+
+const (
+	defaultCacheMinTTL   = time.Hour
+	defaultCacheMaxTTL   = 24 * time.Hour
+	defaultCacheErrorTTL = 10 * time.Minute
+
+	// responses with larger bodies aren't cached
+	maxCachedBodySize = 4 << 20
+)
+
+// prefixes of cache keys
+const (
+	cacheKeyResponse = "response:"
+	cacheKeyResult   = "result:"
+)
+
+// WithCache configures Finder to store HTTP responses and the results of
+// Find() and FindDetailed() in c. Results are cached by URL, so Finders
+// with different options should not share a Cache.
+//
+// Responses are cached for as long as their Cache-Control or Expires
+// headers allow, limited by WithCacheTTL. Responses with "Cache-Control:
+// no-store" are never cached. Failed requests are cached for the duration
+// set with WithCacheErrorTTL. Errors read from the cache only retain their
+// message, except for *HTTPError.
+func WithCache(c Cache) Option {
+	return func(f *Finder) {
+		f.cache = c
+	}
+}
+
+// WithCacheTTL sets the minimum and maximum time responses are cached for.
+// The minimum is used when the response has no caching headers or must be
+// revalidated ("no-cache", "max-age=0"). The defaults are 1 hour and 24
+// hours. Set min to 0 to respect servers' headers strictly.
+func WithCacheTTL(min, max time.Duration) Option {
+	return func(f *Finder) {
+		f.cacheMinTTL = min
+		f.cacheMaxTTL = max
+	}
+}
+
+// WithCacheErrorTTL sets how long failed requests are cached for. The
+// default is 10 minutes. Set ttl to 0 to disable caching of failures.
+// Timeouts and cancelled requests are never cached, nor are results of
+// searches in which they occurred, and results of searches with other
+// server or network errors are cached for at most ttl.
+func WithCacheErrorTTL(ttl time.Duration) Option {
+	return func(f *Finder) {
+		f.cacheErrorTTL = ttl
+	}
+}
+
+// HTTP response or error stored in Cache
+type cachedResponse struct {
+	// final URL after redirects
+	URL        string      `json:"url"`
+	Redirects  []string    `json:"redirects,omitempty"`
+	StatusCode int         `json:"status_code,omitempty"`
+	Status     string      `json:"status,omitempty"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       []byte      `json:"body,omitempty"`
+	// message of a non-HTTP error
+	Err string `json:"error,omitempty"`
+}
+
+// recreate the response or error that was cached
+func (cr *cachedResponse) response() (*http.Response, error) {
+	if cr.Err != "" {
+		return nil, errors.New(cr.Err)
+	}
+	if cr.StatusCode > 299 {
+		return nil, &HTTPError{URL: cr.URL, StatusCode: cr.StatusCode, Status: cr.Status}
+	}
+
+	u, err := urls.Parse(cr.URL)
+	if err != nil {
+		return nil, fmt.Errorf("cached URL: %w", err)
+	}
+	req := &http.Request{Method: "GET", URL: u, Header: http.Header{}}
+	// rebuild redirect chain for redirectChain()
+	prev := req
+	for i := len(cr.Redirects) - 1; i >= 0; i-- {
+		u, err := urls.Parse(cr.Redirects[i])
+		if err != nil {
+			return nil, fmt.Errorf("cached URL: %w", err)
+		}
+		r := &http.Request{Method: "GET", URL: u, Header: http.Header{}}
+		prev.Response = &http.Response{StatusCode: http.StatusFound, Request: r}
+		prev = r
+	}
+
+	return &http.Response{
+		Status:        cr.Status,
+		StatusCode:    cr.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        cr.Header,
+		Body:          io.NopCloser(bytes.NewReader(cr.Body)),
+		ContentLength: int64(len(cr.Body)),
+		Request:       req,
+	}, nil
+}
+
+// Retrieve a URL from the cache or via HTTP, and cache the response.
+func (f *Finder) fetchCached(ctx context.Context, url string) (*http.Response, error) {
+	key := cacheKeyResponse + url
+	if data, ok := f.cache.Get(key); ok {
+		var cr cachedResponse
+		if err := json.Unmarshal(data, &cr); err == nil {
+			f.log.Printf("[cache] %s", url)
+			return cr.response()
+		}
+		f.log.Printf("[cache] invalid entry: %s", url)
+	}
+
+	resp, err := f.fetchHTTP(ctx, url)
+	if err != nil {
+		var herr *HTTPError
+		switch {
+		case errors.As(err, &herr):
+			f.cacheSet(key, &cachedResponse{URL: url, StatusCode: herr.StatusCode, Status: herr.Status}, f.cacheErrorTTL)
+		case ctx.Err() == nil && !IsTimeout(err):
+			f.cacheSet(key, &cachedResponse{URL: url, Err: err.Error()}, f.cacheErrorTTL)
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	if resp.Header.Get("Date") == "" {
+		// expiry is calculated relative to Date
+		resp.Header.Set("Date", now.UTC().Format(http.TimeFormat))
+	}
+	expires, ok := f.cacheExpiry(resp.Header, now)
+	if !ok || !expires.After(now) {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxCachedBodySize+1))
+	if err != nil {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	if len(body) > maxCachedBodySize {
+		// too large to cache: return the response with the data read so far
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return resp, nil
+	}
+	_ = resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	f.cacheSet(key, &cachedResponse{
+		URL:        resp.Request.URL.String(),
+		Redirects:  redirectChain(resp),
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Header:     resp.Header,
+		Body:       body,
+	}, expires.Sub(now))
+
+	return resp, nil
+}
+
+// encode v as JSON and store it in the cache
+func (f *Finder) cacheSet(key string, v interface{}, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		f.log.Printf("[cache] encode %q: %v", key, err)
+		return
+	}
+	f.cache.Set(key, data, ttl)
+}
+
+// return the time a response with the given headers expires, calculated
+// from Cache-Control or Expires and limited to the Finder's minimum and
+// maximum TTL. Returns false if the response must not be cached.
+func (f *Finder) cacheExpiry(h http.Header, now time.Time) (time.Time, bool) {
+	date, err := http.ParseTime(h.Get("Date"))
+	if err != nil {
+		date = now
+	}
+
+	ttl := time.Duration(-1) // unknown
+	for _, directive := range strings.Split(h.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-store":
+			return time.Time{}, false
+		case "no-cache":
+			ttl = 0
+		case "max-age":
+			if n, err := strconv.Atoi(strings.Trim(value, `"`)); err == nil && ttl != 0 {
+				ttl = time.Duration(n) * time.Second
+			}
+		}
+	}
+	if ttl < 0 {
+		if s := h.Get("Expires"); s != "" {
+			ttl = 0 // invalid dates mean "already expired"
+			if t, err := http.ParseTime(s); err == nil && t.After(date) {
+				ttl = t.Sub(date)
+			}
+		}
+	}
+
+	if ttl < f.cacheMinTTL {
+		ttl = f.cacheMinTTL
+	}
+	if ttl > f.cacheMaxTTL {
+		ttl = f.cacheMaxTTL
+	}
+	return date.Add(ttl), true
+}
+
+// search URL, using a cached result if possible
+func (f *Finder) findURL(ctx context.Context, url string) (*Result, error) {
+	if f.cache == nil {
+		return f.newParser().parseURL(ctx, url)
+	}
+
+	key := cacheKeyResult + url
+	if data, ok := f.cache.Get(key); ok {
+		var res Result
+		if err := json.Unmarshal(data, &res); err == nil {
+			f.log.Printf("[cache] result: %s", url)
+			return &res, nil
+		}
+		f.log.Printf("[cache] invalid result: %s", url)
+	}
+
+	p := f.newParser()
+	res, err := p.parseURL(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	// results expire with the page they were found in
+	if !p.expires.IsZero() {
+		f.cacheSet(key, res, f.resultTTL(res, time.Until(p.expires)))
+	}
+	return res, nil
+}
+
+// return how long to cache res, given the TTL of its page. Results are
+// not cached if a source timed out or was cancelled, and expire after
+// the error TTL if a source failed in a way that may be temporary, e.g.
+// a server or network error.
+func (f *Finder) resultTTL(res *Result, ttl time.Duration) time.Duration {
+	for _, sr := range res.Reports {
+		var herr *HTTPError
+		switch err := sr.Err; {
+		case err == nil, errors.Is(err, ErrNotImage):
+		case IsTimeout(err), errors.Is(err, context.Canceled):
+			return 0
+		case errors.As(err, &herr) && herr.StatusCode < 500:
+		default:
+			ttl = min(ttl, f.cacheErrorTTL)
+		}
+	}
+	return ttl
+}
@@ -0,0 +1,139 @@
+// MIT License
+//
+// Copyright (c) 2024 yulog
+
+package favicon
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FileCache is a Cache that stores each entry in a file in a directory.
+// Entries survive restarts and may be shared by several processes. Errors
+// reading and writing files are treated as cache misses.
+type FileCache struct {
+	dir string
+}
+
+var _ Cache = (*FileCache)(nil)
+
+const (
+	// suffix of cache files
+	fileCacheExt = ".cache"
+	// prefix of files being written
+	fileCacheTempPrefix = ".tmp-"
+	// temporary files older than this are left over from failed writes
+	fileCacheTempAge = time.Hour
+)
+
+// NewFileCache creates a FileCache that stores entries in dir, creating the
+// directory if necessary.
+func NewFileCache(dir string) (*FileCache, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileCache{dir: dir}, nil
+}
+
+// Get implements Cache.
+func (c *FileCache) Get(key string) ([]byte, bool) {
+	path := c.path(key)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	value, expires, ok := decodeFileCacheEntry(data)
+	if !ok || time.Now().After(expires) {
+		_ = os.Remove(path)
+		return nil, false
+	}
+	return value, true
+}
+
+// Set implements Cache.
+func (c *FileCache) Set(key string, value []byte, ttl time.Duration) {
+	path := c.path(key)
+	if ttl <= 0 {
+		_ = os.Remove(path)
+		return
+	}
+
+	// write to a temporary file and rename it, so readers never see
+	// partial entries
+	tmp, err := os.CreateTemp(c.dir, fileCacheTempPrefix+"*")
+	if err != nil {
+		return
+	}
+	renamed := false
+	defer func() {
+		if !renamed {
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	var hdr [8]byte
+	binary.BigEndian.PutUint64(hdr[:], uint64(time.Now().Add(ttl).UnixNano()))
+	_, err = tmp.Write(append(hdr[:], value...))
+	if cerr := tmp.Close(); err != nil || cerr != nil {
+		return
+	}
+	renamed = os.Rename(tmp.Name(), path) == nil
+}
+
+// Prune deletes expired entries from the cache directory, and temporary
+// files left by writes that failed, e.g. because the process crashed.
+func (c *FileCache) Prune() error {
+	now := time.Now()
+	return filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), fileCacheTempPrefix) {
+			// recent files may still be being written
+			if info, err := d.Info(); err == nil && now.Sub(info.ModTime()) > fileCacheTempAge {
+				_ = os.Remove(path)
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, fileCacheExt) {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil // probably deleted by another process
+		}
+		if _, expires, ok := decodeFileCacheEntry(data); !ok || now.After(expires) {
+			_ = os.Remove(path)
+		}
+		return nil
+	})
+}
+
+// return path of the file for key
+func (c *FileCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+fileCacheExt)
+}
+
+// split a cache file into its value and expiry time
+func decodeFileCacheEntry(data []byte) ([]byte, time.Time, bool) {
+	if len(data) < 8 {
+		return nil, time.Time{}, false
+	}
+	expires := time.Unix(0, int64(binary.BigEndian.Uint64(data[:8])))
+	return data[8:], expires, true
+}
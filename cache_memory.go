@@ -0,0 +1,87 @@
+// MIT License
+//
+// Copyright (c) 2024 yulog
+
+package favicon
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// MemoryCache is an in-memory Cache that evicts the least recently used
+// entries when full.
+type MemoryCache struct {
+	mu      sync.Mutex
+	max     int
+	entries *list.List // most recently used first
+	index   map[string]*list.Element
+}
+
+type memoryEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+var _ Cache = (*MemoryCache)(nil)
+
+// NewMemoryCache creates a MemoryCache that holds up to maxEntries entries.
+// If maxEntries is less than 1, the cache is unbounded.
+func NewMemoryCache(maxEntries int) *MemoryCache {
+	return &MemoryCache{
+		max:     maxEntries,
+		entries: list.New(),
+		index:   map[string]*list.Element{},
+	}
+}
+
+// Get implements Cache.
+func (c *MemoryCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.index[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*memoryEntry)
+	if time.Now().After(e.expires) {
+		c.remove(el)
+		return nil, false
+	}
+	c.entries.MoveToFront(el)
+	return e.value, true
+}
+
+// Set implements Cache.
+func (c *MemoryCache) Set(key string, value []byte, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.index[key]; ok {
+		c.remove(el)
+	}
+	if ttl <= 0 {
+		return
+	}
+	e := &memoryEntry{key: key, value: value, expires: time.Now().Add(ttl)}
+	c.index[key] = c.entries.PushFront(e)
+	for c.max > 0 && c.entries.Len() > c.max {
+		c.remove(c.entries.Back())
+	}
+}
+
+// Len returns the number of entries in the cache, including expired ones
+// that haven't been evicted yet.
+func (c *MemoryCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.entries.Len()
+}
+
+func (c *MemoryCache) remove(el *list.Element) {
+	c.entries.Remove(el)
+	delete(c.index, el.Value.(*memoryEntry).key)
+}
@@ -0,0 +1,257 @@
+// MIT License
+//
+// Copyright (c) 2024 yulog
+
+package favicon
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCache verifies that results and responses are served from the cache.
+func TestCache(t *testing.T) {
+	t.Parallel()
+	newFileCache := func(t *testing.T) Cache {
+		c, err := NewFileCache(t.TempDir())
+		require.Nil(t, err, "create file cache")
+		return c
+	}
+	caches := []struct {
+		name string
+		new  func(t *testing.T) Cache
+	}{
+		{"memory", func(*testing.T) Cache { return NewMemoryCache(100) }},
+		{"file", newFileCache},
+	}
+
+	for _, td := range caches {
+		t.Run(td.name, func(t *testing.T) {
+			t.Parallel()
+			var (
+				mu   sync.Mutex
+				hits = map[string]int{}
+			)
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				hits[r.URL.Path]++
+				mu.Unlock()
+				switch r.URL.Path {
+				case "/old":
+					http.Redirect(w, r, "/", http.StatusMovedPermanently)
+				case "/", "/other":
+					w.Header().Set("Content-Type", "text/html")
+					_, _ = w.Write([]byte(`<html><head><link rel="icon" href="/icon.png"></head></html>`))
+				case "/private":
+					w.Header().Set("Cache-Control", "no-store")
+					_, _ = w.Write([]byte(`<html></html>`))
+				case "/favicon.ico":
+					_, _ = w.Write(encodeImage(t, "png", 16, 16))
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer ts.Close()
+			count := func(path string) int {
+				mu.Lock()
+				defer mu.Unlock()
+				return hits[path]
+			}
+
+			f := New(WithClient(ts.Client()), WithLogger(debugLogger{}), WithCache(td.new(t)))
+			res, err := f.FindDetailed(ts.URL + "/old")
+			require.Nil(t, err, "unexpected error")
+			require.Equal(t, 2, len(res.Icons), "unexpected favicon count")
+
+			// second search is served from the result cache
+			cached, err := f.FindDetailed(ts.URL + "/old")
+			require.Nil(t, err, "unexpected error")
+			assert.Equal(t, res.URL, cached.URL, "unexpected URL")
+			assert.Equal(t, res.Redirects, cached.Redirects, "unexpected redirects")
+			assert.Equal(t, len(res.Icons), len(cached.Icons), "unexpected favicon count")
+			require.NotNil(t, cached.Report(SourceManifest), "missing manifest report")
+			assert.False(t, cached.Report(SourceManifest).OK(), "manifest error not cached")
+			assert.Equal(t, 1, count("/old"), "page refetched")
+
+			// another page on the same site reuses cached resources,
+			// including failures
+			_, err = f.Find(ts.URL + "/other")
+			require.Nil(t, err, "unexpected error")
+			assert.Equal(t, 1, count("/"), "redirect target refetched")
+			assert.Equal(t, 1, count("/other"), "unexpected page fetch count")
+			assert.Equal(t, 1, count("/manifest.json"), "404 refetched")
+			assert.Equal(t, 1, count("/favicon.ico"), "well-known icon refetched")
+
+			// no-store responses aren't cached
+			for i := 0; i < 2; i++ {
+				_, err = f.Find(ts.URL + "/private")
+				require.Nil(t, err, "unexpected error")
+			}
+			assert.Equal(t, 2, count("/private"), "no-store response cached")
+
+			// redirects are rebuilt from cached responses
+			res, err = f.newParser().parseURL(context.Background(), ts.URL+"/old")
+			require.Nil(t, err, "unexpected error")
+			assert.Equal(t, ts.URL+"/", res.URL, "unexpected URL")
+			assert.Equal(t, []string{ts.URL + "/old"}, res.Redirects, "unexpected redirects")
+		})
+	}
+}
+
+// TestCacheExpiry verifies TTLs calculated from HTTP headers.
+func TestCacheExpiry(t *testing.T) {
+	t.Parallel()
+	var (
+		now  = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		date = now.Add(-time.Minute).Format(http.TimeFormat)
+		f    = New(WithCacheTTL(time.Minute, time.Hour))
+	)
+	tests := []struct {
+		name   string
+		header http.Header
+		x      time.Duration // expected TTL relative to now
+		xok    bool
+	}{
+		{"no-headers", http.Header{}, time.Minute, true},
+		{"max-age", http.Header{"Cache-Control": {"public, max-age=600"}}, 10 * time.Minute, true},
+		{"max-age-date", http.Header{"Cache-Control": {"max-age=600"}, "Date": {date}}, 9 * time.Minute, true},
+		{"max-age-clamped", http.Header{"Cache-Control": {"max-age=86400"}}, time.Hour, true},
+		{"no-cache", http.Header{"Cache-Control": {"no-cache, max-age=600"}}, time.Minute, true},
+		{"no-store", http.Header{"Cache-Control": {"no-store"}}, 0, false},
+		{"expires", http.Header{"Expires": {now.Add(30 * time.Minute).Format(http.TimeFormat)}}, 30 * time.Minute, true},
+		{"expires-invalid", http.Header{"Expires": {"0"}}, time.Minute, true},
+		{"max-age-overrides-expires", http.Header{"Cache-Control": {"max-age=120"}, "Expires": {"0"}}, 2 * time.Minute, true},
+	}
+
+	for _, td := range tests {
+		t.Run(td.name, func(t *testing.T) {
+			t.Parallel()
+			expires, ok := f.cacheExpiry(td.header, now)
+			require.Equal(t, td.xok, ok, "unexpected cacheability")
+			if ok {
+				assert.Equal(t, td.x, expires.Sub(now), "unexpected TTL")
+			}
+		})
+	}
+}
+
+// TestCacheTimeout verifies that results aren't cached if a source timed out.
+func TestCacheTimeout(t *testing.T) {
+	t.Parallel()
+	var (
+		mu   sync.Mutex
+		slow = true
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(`<html><head><link rel="manifest" href="/manifest.json"></head></html>`))
+		case "/manifest.json":
+			mu.Lock()
+			wait := slow
+			slow = false
+			mu.Unlock()
+			if wait {
+				select {
+				case <-r.Context().Done():
+				case <-time.After(time.Second):
+				}
+			}
+			w.Header().Set("Content-Type", "application/manifest+json")
+			_, _ = w.Write([]byte(`{"icons": [{"src": "/icon.png", "sizes": "192x192", "type": "image/png"}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	client := *ts.Client()
+	client.Timeout = 100 * time.Millisecond
+	f := New(WithClient(&client), WithCache(NewMemoryCache(100)), IgnoreWellKnown)
+	res, err := f.FindDetailed(ts.URL + "/")
+	require.Nil(t, err, "unexpected error")
+	require.NotNil(t, res.Report(SourceManifest), "missing manifest report")
+	require.True(t, IsTimeout(res.Report(SourceManifest).Err), "expected manifest timeout")
+	assert.Equal(t, 0, len(res.Icons), "unexpected favicon count")
+
+	res, err = f.FindDetailed(ts.URL + "/")
+	require.Nil(t, err, "unexpected error")
+	assert.True(t, res.Report(SourceManifest).OK(), "manifest timeout cached")
+	assert.Equal(t, 1, len(res.Icons), "unexpected favicon count")
+}
+
+// TestMemoryCache verifies expiry and LRU eviction.
+func TestMemoryCache(t *testing.T) {
+	t.Parallel()
+	c := NewMemoryCache(2)
+	c.Set("a", []byte("1"), time.Hour)
+	c.Set("b", []byte("2"), time.Hour)
+	_, ok := c.Get("a") // a is now most recently used
+	require.True(t, ok, "missing entry")
+	c.Set("c", []byte("3"), time.Hour)
+
+	_, ok = c.Get("b")
+	assert.False(t, ok, "least recently used entry not evicted")
+	v, ok := c.Get("a")
+	assert.True(t, ok, "recently used entry evicted")
+	assert.Equal(t, []byte("1"), v, "unexpected value")
+	assert.Equal(t, 2, c.Len(), "unexpected length")
+
+	c.Set("d", []byte("4"), time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	_, ok = c.Get("d")
+	assert.False(t, ok, "expired entry returned")
+}
+
+// TestFileCache verifies entries are persisted and expire.
+func TestFileCache(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	c, err := NewFileCache(dir)
+	require.Nil(t, err, "create cache")
+	c.Set("a", []byte("1"), time.Hour)
+	c.Set("b", []byte("2"), time.Nanosecond)
+
+	c, err = NewFileCache(dir)
+	require.Nil(t, err, "reopen cache")
+	v, ok := c.Get("a")
+	assert.True(t, ok, "missing entry")
+	assert.Equal(t, []byte("1"), v, "unexpected value")
+
+	time.Sleep(time.Millisecond)
+	require.Nil(t, c.Prune(), "prune cache")
+	_, ok = c.Get("b")
+	assert.False(t, ok, "expired entry returned")
+	_, ok = c.Get("a")
+	assert.True(t, ok, "pruned unexpired entry")
+
+	// failed writes leave no temporary files
+	require.Nil(t, os.Mkdir(c.path("dir"), 0o700), "create directory")
+	c.Set("dir", []byte("3"), time.Hour)
+	tmps, err := filepath.Glob(filepath.Join(dir, fileCacheTempPrefix+"*"))
+	require.Nil(t, err, "list temporary files")
+	assert.Empty(t, tmps, "temporary file left behind")
+
+	// ...and Prune removes those left by crashes, but not recent ones
+	var (
+		stale  = filepath.Join(dir, fileCacheTempPrefix+"stale")
+		recent = filepath.Join(dir, fileCacheTempPrefix+"recent")
+		old    = time.Now().Add(-2 * fileCacheTempAge)
+	)
+	require.Nil(t, os.WriteFile(stale, []byte("x"), 0o600), "write file")
+	require.Nil(t, os.Chtimes(stale, old, old), "set file time")
+	require.Nil(t, os.WriteFile(recent, []byte("x"), 0o600), "write file")
+	require.Nil(t, c.Prune(), "prune cache")
+	assert.NoFileExists(t, stale, "stale temporary file not removed")
+	assert.FileExists(t, recent, "recent temporary file removed")
+}
@@ -0,0 +1,87 @@
+// MIT License
+//
+// Copyright (c) 2024 yulog
+
+package favicon
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"mime"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+)
+
+// number of bytes examined to detect a document's encoding. The HTML
+// standard requires <meta charset> to be within the first 1024 bytes.
+const charsetPeekSize = 1024
+
+// return a reader that converts r to UTF-8. The encoding is determined
+// from the BOM, contentType and <meta> tags, as a browser would, and
+// stored in p.charset.
+func (p *parser) decodeReader(r io.Reader, contentType string) (io.Reader, error) {
+	br := bufio.NewReaderSize(r, charsetPeekSize)
+	data, err := br.Peek(charsetPeekSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+
+	enc, name, certain := charset.DetermineEncoding(data, contentType)
+	// without a BOM or Content-Type charset, DetermineEncoding guesses,
+	// e.g. windows-1252 for an ASCII head. Only trust a declared charset,
+	// and treat everything else as UTF-8.
+	if !certain {
+		enc, name = charset.Lookup(metaCharset(data))
+		if enc == nil {
+			enc, name = encoding.Nop, "utf-8"
+		}
+	}
+	p.charset = name
+	p.find.log.Printf("charset: %s", name)
+	if name == "utf-8" {
+		return br, nil
+	}
+	return enc.NewDecoder().Reader(br), nil
+}
+
+// return the charset declared by a <meta charset> or <meta
+// http-equiv="Content-Type"> tag in data, or "" if there is none
+func metaCharset(data []byte) string {
+	z := html.NewTokenizer(bytes.NewReader(data))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return ""
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tag, more := z.TagName()
+			if string(tag) != "meta" {
+				continue
+			}
+			var cs, httpEquiv, content string
+			for more {
+				var k, v []byte
+				k, v, more = z.TagAttr()
+				switch string(k) {
+				case "charset":
+					cs = strings.TrimSpace(string(v))
+				case "http-equiv":
+					httpEquiv = string(v)
+				case "content":
+					content = string(v)
+				}
+			}
+			if cs != "" {
+				return cs
+			}
+			if strings.EqualFold(httpEquiv, "content-type") {
+				if _, params, err := mime.ParseMediaType(content); err == nil && params["charset"] != "" {
+					return params["charset"]
+				}
+			}
+		}
+	}
+}
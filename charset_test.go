@@ -0,0 +1,102 @@
+// MIT License
+//
+// Copyright (c) 2024 yulog
+
+package favicon
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// TestCharset verifies that non-UTF-8 pages are decoded before parsing.
+func TestCharset(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name        string
+		enc         encoding.Encoding
+		contentType string // Content-Type header
+		meta        string // <meta> tag
+		path        string // icon path
+		xpath       string // escaped icon path
+		xcharset    string
+	}{
+		{"shift_jis-header", japanese.ShiftJIS, "text/html; charset=Shift_JIS", "",
+			"/アイコン.png", "/%E3%82%A2%E3%82%A4%E3%82%B3%E3%83%B3.png", "shift_jis"},
+		{"euc-jp-meta", japanese.EUCJP, "text/html", `<meta charset="EUC-JP">`,
+			"/画像/icon.png", "/%E7%94%BB%E5%83%8F/icon.png", "euc-jp"},
+		{"gbk-http-equiv", simplifiedchinese.GBK, "text/html", `<meta http-equiv="Content-Type" content="text/html; charset=gbk">`,
+			"/图标.png", "/%E5%9B%BE%E6%A0%87.png", "gbk"},
+		{"windows-1252-meta", charmap.Windows1252, "text/html", `<meta charset="windows-1252">`,
+			"/café.png", "/caf%C3%A9.png", "windows-1252"},
+		{"utf-8", encoding.Nop, "text/html", "",
+			"/café.png", "/caf%C3%A9.png", "utf-8"},
+	}
+
+	for _, td := range tests {
+		td := td
+		t.Run(td.name, func(t *testing.T) {
+			t.Parallel()
+			html := `<html><head>` + td.meta + `<link rel="icon" href="` + td.path + `"></head></html>`
+			page, err := td.enc.NewEncoder().Bytes([]byte(html))
+			require.Nil(t, err, "encode page")
+
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", td.contentType)
+				_, _ = w.Write(page)
+			}))
+			defer ts.Close()
+
+			f := New(WithClient(ts.Client()), WithLogger(debugLogger{}), IgnoreManifest, IgnoreWellKnown)
+			res, err := f.FindDetailed(ts.URL + "/")
+			require.Nil(t, err, "unexpected error")
+			assert.Equal(t, td.xcharset, res.Charset, "unexpected charset")
+			require.Equal(t, 1, len(res.Icons), "unexpected favicon count")
+			assert.Equal(t, ts.URL+td.xpath, res.Icons[0].URL, "unexpected URL")
+
+			// readers without a Content-Type rely on <meta> tags
+			if td.meta == "" {
+				return
+			}
+			icons, err := f.FindReader(bytes.NewReader(page), ts.URL)
+			require.Nil(t, err, "unexpected error")
+			require.Equal(t, 1, len(icons), "unexpected favicon count")
+			assert.Equal(t, ts.URL+td.xpath, icons[0].URL, "unexpected URL")
+		})
+	}
+}
+
+// TestCharsetUndeclared verifies that pages without a declared charset
+// are read as UTF-8, even if their first 1024 bytes are ASCII.
+func TestCharsetUndeclared(t *testing.T) {
+	t.Parallel()
+	page := []byte(`<html><head><!-- ` + strings.Repeat("x", 1024) + ` -->` +
+		`<link rel="icon" href="/café.png"></head></html>`)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write(page)
+	}))
+	defer ts.Close()
+
+	f := New(WithClient(ts.Client()), WithLogger(debugLogger{}), IgnoreManifest, IgnoreWellKnown)
+	res, err := f.FindDetailed(ts.URL + "/")
+	require.Nil(t, err, "unexpected error")
+	assert.Equal(t, "utf-8", res.Charset, "unexpected charset")
+	require.Equal(t, 1, len(res.Icons), "unexpected favicon count")
+	assert.Equal(t, ts.URL+"/caf%C3%A9.png", res.Icons[0].URL, "unexpected URL")
+
+	icons, err := f.FindReader(bytes.NewReader(page), ts.URL)
+	require.Nil(t, err, "unexpected error")
+	require.Equal(t, 1, len(icons), "unexpected favicon count")
+	assert.Equal(t, ts.URL+"/caf%C3%A9.png", icons[0].URL, "unexpected URL")
+}
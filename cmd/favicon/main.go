@@ -37,6 +37,10 @@ var (
 	flagCSV     = fs.Bool("csv", false, "output favicon list as CSV")
 	flagTSV     = fs.Bool("tsv", false, "output favicon list as TSV")
 	flagSquare  = fs.Bool("square", false, "only show square icons")
+	flagVerify  = fs.Bool("verify", false, "download icons to check their real format and size")
+	flagICO     = fs.Bool("expand-ico", false, "list each image in ICO files")
+	flagRobots  = fs.Bool("robots", false, "obey robots.txt")
+	flagCache   = fs.String("cache", "", "cache responses and results in `directory`")
 	flagVerbose = fs.Bool("v", false, "show informational messages")
 	flagVersion = fs.Bool("version", false, "show version number and exit")
 
@@ -83,6 +87,21 @@ func main() {
 		opts = append(opts, favicon.WithLogger(log))
 	}
 
+	if *flagVerify {
+		opts = append(opts, favicon.WithVerify())
+	}
+	if *flagICO {
+		opts = append(opts, favicon.ExpandICO)
+	}
+	if *flagRobots {
+		opts = append(opts, favicon.WithRobots(""))
+	}
+	if *flagCache != "" {
+		c, err := favicon.NewFileCache(*flagCache)
+		checkErr(err)
+		opts = append(opts, favicon.WithCache(c))
+	}
+
 	f := favicon.New(opts...)
 	icons, err := f.Find(u)
 	checkErr(err)
@@ -0,0 +1,160 @@
+// MIT License
+//
+// Copyright (c) 2024 yulog
+
+package favicon
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// default maximum size of icons retrieved by Fetch and Download
+const defaultMaxIconSize = 1 << 20
+
+// number of bytes used by http.DetectContentType
+const sniffSize = 512
+
+// Errors returned by Fetch and Download.
+var (
+	// ErrEmptyIcon is returned if the server returns no data.
+	ErrEmptyIcon = errors.New("empty icon")
+	// ErrNotImage is returned if the data aren't an image, e.g. an HTML
+	// error page returned with status 200 (a "soft 404").
+	ErrNotImage = errors.New("not an image")
+	// ErrIconTooLarge is returned if the icon is larger than the limit
+	// set with WithMaxIconSize.
+	ErrIconTooLarge = errors.New("icon too large")
+)
+
+// WithMaxIconSize sets the maximum number of bytes Fetch and Download
+// retrieve. Larger icons cause ErrIconTooLarge. The default is 1 MiB.
+func WithMaxIconSize(n int64) Option {
+	return func(f *Finder) {
+		f.maxIconSize = n
+	}
+}
+
+// IconData is an icon retrieved by Fetch.
+type IconData struct {
+	// URL data were retrieved from, after following redirects.
+	URL  string
+	Data []byte
+	// MIME type determined from data, not the Content-Type header.
+	ContentType string
+	// Cache validators sent by the server. May be empty.
+	ETag         string
+	LastModified string
+}
+
+// Fetch retrieves an icon using the Finder's HTTP client and headers.
+// It returns ErrEmptyIcon, ErrNotImage or ErrIconTooLarge if the response
+// isn't a usable image.
+func (f *Finder) Fetch(ctx context.Context, icon *Icon) (*IconData, error) {
+	var buf bytes.Buffer
+	data, err := f.download(ctx, icon, &buf)
+	if err != nil {
+		return nil, err
+	}
+	data.Data = buf.Bytes()
+	return data, nil
+}
+
+// Download retrieves an icon using the Finder's HTTP client and headers,
+// and writes it to w. It returns the number of bytes written. The data are
+// validated before anything is written to w, but w may have received
+// partial data if ErrIconTooLarge or a network error is returned.
+func (f *Finder) Download(ctx context.Context, icon *Icon, w io.Writer) (int64, error) {
+	var cw countWriter
+	_, err := f.download(ctx, icon, io.MultiWriter(w, &cw))
+	return cw.n, err
+}
+
+// retrieve icon, check its data and write them to w. The returned IconData
+// has no Data.
+func (f *Finder) download(ctx context.Context, icon *Icon, w io.Writer) (*IconData, error) {
+	resp, err := f.fetch(ctx, icon.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.ContentLength > f.maxIconSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrIconTooLarge, resp.ContentLength)
+	}
+
+	head := make([]byte, sniffSize)
+	n, err := io.ReadFull(resp.Body, head)
+	eof := err == io.EOF || err == io.ErrUnexpectedEOF
+	if err != nil && !eof {
+		return nil, fmt.Errorf("read icon: %w", err)
+	}
+	head = head[:n]
+	if n == 0 {
+		return nil, ErrEmptyIcon
+	}
+
+	ct := sniffContentType(head)
+	// the root <svg> element may follow a long prolog, comments, etc.
+	limit := min(verifyReadSize, int(f.maxIconSize))
+	for !strings.HasPrefix(ct, "image/") && isTruncatedXML(head) && !eof && len(head) < limit {
+		buf := make([]byte, min(sniffSize*8, limit-len(head)))
+		n, err := io.ReadFull(resp.Body, buf)
+		eof = err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !eof {
+			return nil, fmt.Errorf("read icon: %w", err)
+		}
+		head = append(head, buf[:n]...)
+		ct = sniffContentType(head)
+	}
+	n = len(head)
+
+	data := &IconData{
+		URL:          resp.Request.URL.String(),
+		ContentType:  ct,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+	if !strings.HasPrefix(data.ContentType, "image/") {
+		return nil, fmt.Errorf("%w: %s", ErrNotImage, data.ContentType)
+	}
+
+	if _, err := w.Write(head); err != nil {
+		return nil, err
+	}
+	// read one byte more than the limit to detect oversized icons
+	written, err := io.Copy(w, io.LimitReader(resp.Body, f.maxIconSize-int64(n)+1))
+	if err != nil {
+		return nil, fmt.Errorf("read icon: %w", err)
+	}
+	if int64(n)+written > f.maxIconSize {
+		return nil, ErrIconTooLarge
+	}
+	f.log.Printf("(download) %s: %s, %d bytes", icon.URL, data.ContentType, int64(n)+written)
+	return data, nil
+}
+
+// determine MIME type of data using http.DetectContentType, which doesn't
+// recognise SVG.
+func sniffContentType(data []byte) string {
+	ct := http.DetectContentType(data)
+	if !strings.HasPrefix(ct, "image/") && isXML(data) {
+		if _, err := readSVGInfo(data); err == nil {
+			return mimeSVG
+		}
+	}
+	return ct
+}
+
+// counts bytes written
+type countWriter struct{ n int64 }
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
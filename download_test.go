@@ -0,0 +1,120 @@
+// MIT License
+//
+// Copyright (c) 2024 yulog
+
+package favicon
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestFetch verifies retrieval and validation of icon data.
+func TestFetch(t *testing.T) {
+	t.Parallel()
+	var (
+		png = encodeImage(t, "png", 32, 32)
+		svg = []byte(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 16 16"></svg>`)
+		// root element after the first 512 bytes, as written by editors
+		prolog = []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<!-- Created with Inkscape (http://www.inkscape.org/) ` + strings.Repeat("x", 600) + ` -->
+<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 16 16"></svg>`)
+		ua string
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ua = r.Header.Get("User-Agent")
+		switch r.URL.Path {
+		case "/icon.png":
+			w.Header().Set("ETag", `"abc"`)
+			w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+			_, _ = w.Write(png)
+		case "/icon.svg":
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = w.Write(svg)
+		case "/prolog.svg":
+			w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+			_, _ = w.Write(prolog)
+		case "/soft-404.png":
+			_, _ = w.Write([]byte("<!DOCTYPE html><html><body>Not Found</body></html>"))
+		case "/comment.svg":
+			// HTML starting with a comment, and no end to the body
+			_, _ = w.Write([]byte("<!-- page -->\n<!DOCTYPE html><html><body>Not Found" +
+				strings.Repeat(" ", sniffSize) + "</body>"))
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		case "/empty.ico":
+		case "/large.png":
+			_, _ = w.Write(append(png, make([]byte, 2048)...))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	var (
+		ctx = context.Background()
+		f   = New(WithClient(ts.Client()), WithLogger(debugLogger{}), WithMaxIconSize(1024))
+	)
+
+	data, err := f.Fetch(ctx, &Icon{URL: ts.URL + "/icon.png"})
+	require.Nil(t, err, "unexpected error")
+	assert.Equal(t, png, data.Data, "unexpected data")
+	assert.Equal(t, "image/png", data.ContentType, "unexpected content type")
+	assert.Equal(t, `"abc"`, data.ETag, "unexpected ETag")
+	assert.Equal(t, "Mon, 02 Jan 2006 15:04:05 GMT", data.LastModified, "unexpected Last-Modified")
+	assert.Equal(t, UserAgent, ua, "unexpected User-Agent")
+
+	data, err = f.Fetch(ctx, &Icon{URL: ts.URL + "/icon.svg"})
+	require.Nil(t, err, "unexpected error")
+	assert.Equal(t, "image/svg+xml", data.ContentType, "unexpected content type")
+
+	data, err = f.Fetch(ctx, &Icon{URL: ts.URL + "/prolog.svg"})
+	require.Nil(t, err, "unexpected error")
+	assert.Equal(t, "image/svg+xml", data.ContentType, "unexpected content type")
+	assert.Equal(t, prolog, data.Data, "unexpected data")
+
+	tests := []struct {
+		path string
+		x    error
+	}{
+		{"/soft-404.png", ErrNotImage},
+		{"/empty.ico", ErrEmptyIcon},
+		{"/large.png", ErrIconTooLarge},
+	}
+	for _, td := range tests {
+		_, err = f.Fetch(ctx, &Icon{URL: ts.URL + td.path})
+		assert.True(t, errors.Is(err, td.x), "%s: unexpected error: %v", td.path, err)
+	}
+
+	// reading stops at the <html> root element
+	tctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, err = f.Fetch(tctx, &Icon{URL: ts.URL + "/comment.svg"})
+	assert.True(t, errors.Is(err, ErrNotImage), "unexpected error: %v", err)
+
+	_, err = f.Fetch(ctx, &Icon{URL: ts.URL + "/missing.png"})
+	var herr *HTTPError
+	assert.True(t, errors.As(err, &herr), "expected HTTPError, got %v", err)
+
+	// Download writes icon to writer
+	var buf bytes.Buffer
+	n, err := f.Download(ctx, &Icon{URL: ts.URL + "/icon.png"}, &buf)
+	require.Nil(t, err, "unexpected error")
+	assert.Equal(t, int64(len(png)), n, "unexpected length")
+	assert.Equal(t, png, buf.Bytes(), "unexpected data")
+
+	// nothing written for invalid icons
+	buf.Reset()
+	_, err = f.Download(ctx, &Icon{URL: ts.URL + "/soft-404.png"}, &buf)
+	assert.True(t, errors.Is(err, ErrNotImage), "unexpected error: %v", err)
+	assert.Equal(t, 0, buf.Len(), "unexpected data")
+}
@@ -15,6 +15,7 @@
 package favicon
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"mime"
@@ -22,6 +23,8 @@ import (
 	urls "net/url"
 	"path/filepath"
 	"sort"
+	"sync"
+	"time"
 
 	gq "github.com/PuerkitoBio/goquery"
 	"golang.org/x/net/html"
@@ -45,6 +48,9 @@ var (
 	client = &http.Client{} // default client used by Finder
 )
 
+// default maximum number of simultaneous requests made by a Finder
+const defaultConcurrency = 4
+
 func init() {
 	finder = New()
 }
@@ -74,6 +80,18 @@ func WithClient(client *http.Client) Option {
 	}
 }
 
+// WithConcurrency sets the maximum number of requests a Finder makes
+// simultaneously when retrieving the manifest and probing well-known
+// locations. Values less than 1 are treated as 1, i.e. serial requests.
+func WithConcurrency(n int) Option {
+	return func(f *Finder) {
+		if n < 1 {
+			n = 1
+		}
+		f.concurrency = n
+	}
+}
+
 // WithFilter only returns Icons accepted by Filter functions.
 func WithFilter(filter ...Filter) Option {
 	return func(f *Finder) {
@@ -101,10 +119,11 @@ func OnlyMimeType(mimeType ...string) Option {
 	})
 }
 
-// MinWidth ignores icons smaller than the given width.
+// MinWidth ignores icons smaller than the given width. Scalable icons are
+// always accepted by MinWidth, MaxWidth, MinHeight and MaxHeight.
 func MinWidth(width int) Option {
 	return WithFilter(func(icon *Icon) *Icon {
-		if icon.Width < width {
+		if icon.Width < width && !icon.Scalable {
 			return nil
 		}
 		return icon
@@ -114,7 +133,7 @@ func MinWidth(width int) Option {
 // MaxWidth ignores icons larger than the given width.
 func MaxWidth(width int) Option {
 	return WithFilter(func(icon *Icon) *Icon {
-		if icon.Width > width {
+		if icon.Width > width && !icon.Scalable {
 			return nil
 		}
 		return icon
@@ -124,7 +143,7 @@ func MaxWidth(width int) Option {
 // MinHeight ignores icons smaller than the given height.
 func MinHeight(height int) Option {
 	return WithFilter(func(icon *Icon) *Icon {
-		if icon.Height < height {
+		if icon.Height < height && !icon.Scalable {
 			return nil
 		}
 		return icon
@@ -134,13 +153,31 @@ func MinHeight(height int) Option {
 // MaxHeight ignores icons larger than the given height.
 func MaxHeight(height int) Option {
 	return WithFilter(func(icon *Icon) *Icon {
-		if icon.Height > height {
+		if icon.Height > height && !icon.Scalable {
 			return nil
 		}
 		return icon
 	})
 }
 
+// ForColorScheme ignores icons meant for a different colour scheme, e.g.
+// icons with media="(prefers-color-scheme: dark)" if scheme is
+// ColorSchemeLight. Icons for any colour scheme are accepted unless there
+// is a variant for scheme of the same kind and size, e.g. icon.svg is
+// ignored if the page also has icon-dark.svg for ColorSchemeDark.
+func ForColorScheme(scheme string) Option {
+	filter := WithFilter(func(icon *Icon) *Icon {
+		if s := icon.ColorScheme(); s != "" && s != scheme {
+			return nil
+		}
+		return icon
+	})
+	return func(f *Finder) {
+		filter(f)
+		f.colorScheme = scheme
+	}
+}
+
 var (
 	// IgnoreWellKnown ignores common locations like /favicon.ico.
 	IgnoreWellKnown Option = func(f *Finder) { f.ignoreWellKnown = true }
@@ -148,9 +185,10 @@ var (
 	// IgnoreManifest ignores manifest.json files.
 	IgnoreManifest Option = func(f *Finder) { f.ignoreManifest = true }
 
-	// IgnoreNoSize ignores icons with no specified size.
+	// IgnoreNoSize ignores icons with no specified size. Scalable icons
+	// are not ignored.
 	IgnoreNoSize Option = WithFilter(func(icon *Icon) *Icon {
-		if icon.Width == 0 || icon.Height == 0 {
+		if (icon.Width == 0 || icon.Height == 0) && !icon.Scalable {
 			return nil
 		}
 		return icon
@@ -175,8 +213,26 @@ var (
 		return icon
 	})
 
-	// SortByWidth sorts icons by width (largest first), and then by image type
-	// (PNG > JPEG > SVG > ICO).
+	// IgnoreMasks ignores monochrome mask icons, e.g. Safari pinned-tab
+	// icons. See Icon.Mask.
+	IgnoreMasks Option = WithFilter(func(icon *Icon) *Icon {
+		if icon.Mask {
+			return nil
+		}
+		return icon
+	})
+
+	// OnlyMasks ignores all icons except monochrome mask icons.
+	OnlyMasks Option = WithFilter(func(icon *Icon) *Icon {
+		if !icon.Mask {
+			return nil
+		}
+		return icon
+	})
+
+	// SortByWidth sorts icons by width (largest first, scalable icons before
+	// all others, masks and then logos and social images last), and then
+	// by image type (PNG > JPEG > SVG > ICO).
 	SortByWidth Option = WithSorter(func(icons []*Icon) sort.Interface {
 		return ByWidth(icons)
 	})
@@ -189,36 +245,67 @@ var (
 // By default, a Finder looks in the following places:
 //
 // The HTML page at the given URL for...
-//   - icons in <link> tags
+//   - icons in <link> tags, including Safari mask icons
 //   - Open Graph images
 //   - Twitter images
+//   - Windows tile images in msapplication-* <meta> tags
+//   - logos in schema.org JSON-LD and microdata
+//   - the logo and photo of the page's h-card
 //
 // The manifest file...
 //   - defined in the HTML page
 //     -- or --
 //   - /manifest.json
 //
-// Standard favicon paths
+// The browserconfig.xml file...
+//   - defined in the HTML page
+//     -- or --
+//   - /browserconfig.xml
+//
+// Standard favicon paths (see DefaultWellKnownPaths)
 //   - /favicon.ico
 //   - /apple-touch-icon.png
+//   - ...
 //
-// Pass the IgnoreManifest and/or IgnoreWellKnown Options to New() to
-// reduce the number of requests made to webservers.
+// Pass the IgnoreManifest, IgnoreBrowserConfig and/or IgnoreWellKnown
+// Options to New() to reduce the number of requests made to webservers.
 type Finder struct {
-	ignoreManifest  bool
-	ignoreWellKnown bool
-	log             Logger
-	client          *http.Client
-	filters         []Filter
-	sorter          Sorter
+	ignoreManifest       bool
+	ignoreBrowserConfig  bool
+	ignoreStructuredData bool
+	ignoreMicroformats   bool
+	separateSocialImages bool
+	ignoreWellKnown      bool
+	verify               bool
+	expandICO            bool
+	maxIconSize          int64
+	concurrency          int
+	cache                Cache
+	cacheMinTTL          time.Duration
+	cacheMaxTTL          time.Duration
+	cacheErrorTTL        time.Duration
+	hosts                *hostLimiter
+	robots               *robotsChecker
+	wellKnownPaths       []string // nil means IconNames
+	wellKnownInPageDir   bool
+	colorScheme          string // preferred by ForColorScheme
+	log                  Logger
+	client               *http.Client
+	filters              []Filter
+	sorter               Sorter
 }
 
 // New creates a new Finder configured with the given options.
 func New(option ...Option) *Finder {
 	f := &Finder{
-		log:     nullLogger{},
-		client:  client,
-		filters: []Filter{},
+		concurrency:   defaultConcurrency,
+		maxIconSize:   defaultMaxIconSize,
+		cacheMinTTL:   defaultCacheMinTTL,
+		cacheMaxTTL:   defaultCacheMaxTTL,
+		cacheErrorTTL: defaultCacheErrorTTL,
+		log:           nullLogger{},
+		client:        client,
+		filters:       []Filter{},
 	}
 	SortByWidth(f) // Default sort option
 	for _, fn := range option {
@@ -230,9 +317,44 @@ func New(option ...Option) *Finder {
 // Find finds favicons for URL.
 func Find(url string) ([]*Icon, error) { return finder.Find(url) }
 
+// FindContext finds favicons for URL. The context is used for all HTTP
+// requests made during the search.
+func FindContext(ctx context.Context, url string) ([]*Icon, error) {
+	return finder.FindContext(ctx, url)
+}
+
 // Find finds favicons for URL.
 func (f *Finder) Find(url string) ([]*Icon, error) {
-	return f.newParser().parseURL(url)
+	return f.FindContext(context.Background(), url)
+}
+
+// FindContext finds favicons for URL. The context is used for all HTTP
+// requests made during the search.
+func (f *Finder) FindContext(ctx context.Context, url string) ([]*Icon, error) {
+	return icons(f.findURL(ctx, url))
+}
+
+// FindDetailed finds favicons for URL and reports the outcome of searching
+// each source.
+func FindDetailed(url string) (*Result, error) { return finder.FindDetailed(url) }
+
+// FindDetailedContext finds favicons for URL and reports the outcome of
+// searching each source. The context is used for all HTTP requests made
+// during the search.
+func FindDetailedContext(ctx context.Context, url string) (*Result, error) {
+	return finder.FindDetailedContext(ctx, url)
+}
+
+// FindDetailed finds favicons for URL and reports the outcome of searching
+// each source.
+func (f *Finder) FindDetailed(url string) (*Result, error) {
+	return f.FindDetailedContext(context.Background(), url)
+}
+
+// FindDetailedContext finds favicons for URL and reports the outcome of
+// searching each source.
+func (f *Finder) FindDetailedContext(ctx context.Context, url string) (*Result, error) {
+	return f.findURL(ctx, url)
 }
 
 // FindReader finds a favicon in HTML. It accepts an optional base URL, which
@@ -241,8 +363,19 @@ func FindReader(r io.Reader, baseURL ...string) ([]*Icon, error) {
 	return finder.FindReader(r, baseURL...)
 }
 
+// FindReaderContext finds a favicon in HTML. It accepts an optional base URL,
+// which is used to resolve relative links.
+func FindReaderContext(ctx context.Context, r io.Reader, baseURL ...string) ([]*Icon, error) {
+	return finder.FindReaderContext(ctx, r, baseURL...)
+}
+
 // FindReader finds a favicon in HTML.
 func (f *Finder) FindReader(r io.Reader, baseURL ...string) ([]*Icon, error) {
+	return f.FindReaderContext(context.Background(), r, baseURL...)
+}
+
+// FindReaderContext finds a favicon in HTML.
+func (f *Finder) FindReaderContext(ctx context.Context, r io.Reader, baseURL ...string) ([]*Icon, error) {
 	p := f.newParser()
 	if len(baseURL) > 0 {
 		u, err := urls.Parse(baseURL[0])
@@ -251,7 +384,7 @@ func (f *Finder) FindReader(r io.Reader, baseURL ...string) ([]*Icon, error) {
 		}
 		p.baseURL = u
 	}
-	return p.parseReader(r)
+	return icons(p.parseReader(ctx, r))
 }
 
 // FindNode finds a favicon in HTML Node. It accepts an optional base URL, which
@@ -260,8 +393,19 @@ func FindNode(n *html.Node, baseURL ...string) ([]*Icon, error) {
 	return finder.FindNode(n, baseURL...)
 }
 
+// FindNodeContext finds a favicon in HTML Node. It accepts an optional base
+// URL, which is used to resolve relative links.
+func FindNodeContext(ctx context.Context, n *html.Node, baseURL ...string) ([]*Icon, error) {
+	return finder.FindNodeContext(ctx, n, baseURL...)
+}
+
 // FindNode finds a favicon in HTML Node.
 func (f *Finder) FindNode(n *html.Node, baseURL ...string) ([]*Icon, error) {
+	return f.FindNodeContext(context.Background(), n, baseURL...)
+}
+
+// FindNodeContext finds a favicon in HTML Node.
+func (f *Finder) FindNodeContext(ctx context.Context, n *html.Node, baseURL ...string) ([]*Icon, error) {
 	p := f.newParser()
 	if len(baseURL) > 0 {
 		u, err := urls.Parse(baseURL[0])
@@ -270,7 +414,7 @@ func (f *Finder) FindNode(n *html.Node, baseURL ...string) ([]*Icon, error) {
 		}
 		p.baseURL = u
 	}
-	return p.parseNode(n)
+	return icons(p.parseNode(ctx, n))
 }
 
 // FindGoQueryDocument finds a favicon in GoQueryDocument. It accepts an optional base URL, which
@@ -279,8 +423,19 @@ func FindGoQueryDocument(doc *gq.Document, baseURL ...string) ([]*Icon, error) {
 	return finder.FindGoQueryDocument(doc, baseURL...)
 }
 
+// FindGoQueryDocumentContext finds a favicon in GoQueryDocument. It accepts an optional base URL,
+// which is used to resolve relative links.
+func FindGoQueryDocumentContext(ctx context.Context, doc *gq.Document, baseURL ...string) ([]*Icon, error) {
+	return finder.FindGoQueryDocumentContext(ctx, doc, baseURL...)
+}
+
 // FindGoQueryDocument finds a favicon in GoQueryDocument.
 func (f *Finder) FindGoQueryDocument(doc *gq.Document, baseURL ...string) ([]*Icon, error) {
+	return f.FindGoQueryDocumentContext(context.Background(), doc, baseURL...)
+}
+
+// FindGoQueryDocumentContext finds a favicon in GoQueryDocument.
+func (f *Finder) FindGoQueryDocumentContext(ctx context.Context, doc *gq.Document, baseURL ...string) ([]*Icon, error) {
 	p := f.newParser()
 	if len(baseURL) > 0 {
 		u, err := urls.Parse(baseURL[0])
@@ -289,34 +444,105 @@ func (f *Finder) FindGoQueryDocument(doc *gq.Document, baseURL ...string) ([]*Ic
 		}
 		p.baseURL = u
 	}
-	return p.parseGoQueryDocument(doc)
+	return icons(p.parseGoQueryDocument(ctx, doc))
+}
+
+// extract Icons from parser result
+func icons(res *Result, err error) ([]*Icon, error) {
+	if err != nil {
+		return nil, err
+	}
+	return res.Icons, nil
 }
 
 // Retrieve a URL and return response body. Returns an error if response status >= 300.
-func (f *Finder) fetchURL(url string) (io.ReadCloser, error) {
-	req, err := http.NewRequest("GET", url, nil)
+func (f *Finder) fetchURL(ctx context.Context, url string) (io.ReadCloser, error) {
+	resp, err := f.fetch(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Retrieve a URL if robots.txt permits. Returns an error if response
+// status >= 300. Caller must close the response body.
+func (f *Finder) fetch(ctx context.Context, url string) (*http.Response, error) {
+	if f.robots != nil {
+		if err := f.checkRobots(ctx, url); err != nil {
+			return nil, err
+		}
+	}
+	return f.fetchResource(ctx, url)
+}
+
+// Retrieve a URL, from the cache if one is set. Returns an error if
+// response status >= 300. Caller must close the response body.
+func (f *Finder) fetchResource(ctx context.Context, url string) (*http.Response, error) {
+	if f.cache != nil {
+		return f.fetchCached(ctx, url)
+	}
+	return f.fetchHTTP(ctx, url)
+}
+
+// Retrieve a URL via HTTP. Returns an error if response status >= 300.
+// Caller must close the response body.
+func (f *Finder) fetchHTTP(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("request URL: %w", err)
 	}
 	req.Header.Set("User-Agent", UserAgent)
 
+	release := func() {}
+	if f.hosts != nil {
+		if release, err = f.hosts.acquire(ctx, req.URL.Host); err != nil {
+			return nil, fmt.Errorf("wait for host %s: %w", req.URL.Host, err)
+		}
+	}
+
 	resp, err := f.client.Do(req)
 	if err != nil {
+		release()
 		return nil, fmt.Errorf("retrieve URL: %w", err)
 	}
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: release}
 	f.log.Printf("[%d] %s", resp.StatusCode, url)
 
 	if resp.StatusCode > 299 {
 		_ = resp.Body.Close()
-		return nil, fmt.Errorf("[%d] %s", resp.StatusCode, resp.Status)
+		return nil, &HTTPError{URL: url, StatusCode: resp.StatusCode, Status: resp.Status}
 	}
 
-	return resp.Body, nil
+	return resp, nil
+}
+
+// call fn for each i in [0, n), running up to f.concurrency calls at once.
+// Returns when all calls have completed.
+func (f *Finder) parallel(n int, fn func(i int)) {
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, f.concurrency)
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
 }
 
 type parser struct {
-	baseURL *urls.URL
-	charset string
+	baseURL    *urls.URL // URL of page
+	docBaseURL *urls.URL // URL set by <base href>, if any
+	redirects  []string  // URLs redirected to baseURL
+	charset    string
+	expires    time.Time // when a cached page expires
 
 	find *Finder
 }
@@ -325,8 +551,14 @@ func (f *Finder) newParser() *parser {
 	return &parser{find: f}
 }
 
+// resolve URL against the document's base URL, i.e. the one set by a
+// <base href> element, falling back to the page's URL.
 func (p *parser) absURL(url string) string {
-	if url == "" || p.baseURL == nil {
+	base := p.baseURL
+	if p.docBaseURL != nil {
+		base = p.docBaseURL
+	}
+	if url == "" || base == nil {
 		return url
 	}
 
@@ -334,10 +566,7 @@ func (p *parser) absURL(url string) string {
 	if err != nil {
 		return ""
 	}
-	if p.baseURL != nil {
-		return p.baseURL.ResolveReference(u).String()
-	}
-	return url
+	return base.ResolveReference(u).String()
 }
 
 // return MIME type based on file extension in URL
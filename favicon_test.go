@@ -5,11 +5,17 @@
 package favicon
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -73,7 +79,7 @@ func TestFindHTML(t *testing.T) {
 	var icons []*Icon
 	icons, err = f.FindReader(file)
 	require.Nil(t, err, "unexpected error")
-	assert.Equal(t, 6, len(icons), "unexpected favicon count")
+	assert.Equal(t, 7, len(icons), "unexpected favicon count")
 }
 
 // TestFindManifest finds favicons in manifest.
@@ -88,7 +94,8 @@ func TestFindManifest(t *testing.T) {
 	p := f.newParser()
 	p.baseURL = mustURL("https://github.com")
 
-	icons := p.parseManifestReader(file)
+	icons, err := p.parseManifestReader(file, "https://github.com/manifest.json")
+	require.Nil(t, err, "unexpected error")
 	assert.Equal(t, 11, len(icons), "unexpected favicon count")
 }
 
@@ -99,8 +106,8 @@ func TestHTTP(t *testing.T) {
 		name, path string
 		xcount     int
 	}{
-		{"github", "./testdata/github", 17},
-		{"kuli", "./testdata/kuli", 7},
+		{"github", "./testdata/github", 18},
+		{"kuli", "./testdata/kuli", 8},
 		{"mozilla", "./testdata/mozilla", 4},
 		{"no-markup", "./testdata/no-markup", 3},
 	}
@@ -130,8 +137,8 @@ func TestIgnore(t *testing.T) {
 		xcount          int
 	}{
 		// ignore well-known
-		{"github-ignore-well-known", "./testdata/github", true, false, 17},
-		{"kuli-ignore-well-known", "./testdata/kuli", true, false, 7},
+		{"github-ignore-well-known", "./testdata/github", true, false, 18},
+		{"kuli-ignore-well-known", "./testdata/kuli", true, false, 8},
 		{"mozilla-ignore-well-known", "./testdata/mozilla", true, false, 4},
 		{"no-markup-ignore-well-known", "./testdata/no-markup", true, false, 2},
 		{"manifest-only-ignore-well-known", "./testdata/manifest-only", true, false, 2},
@@ -141,8 +148,8 @@ func TestIgnore(t *testing.T) {
 		{"manifest-only-ignore-manifest", "./testdata/manifest-only", false, true, 0},
 
 		// ignore well-known & manifest
-		{"github-ignore-both", "./testdata/github", true, true, 6},
-		{"kuli-ignore-both", "./testdata/kuli", true, true, 5},
+		{"github-ignore-both", "./testdata/github", true, true, 7},
+		{"kuli-ignore-both", "./testdata/kuli", true, true, 6},
 		{"mozilla-ignore-both", "./testdata/mozilla", true, true, 4},
 		{"no-markup-ignore-both", "./testdata/no-markup", true, true, 0},
 		{"manifest-only-both", "./testdata/manifest-only", true, true, 0},
@@ -183,17 +190,19 @@ func TestFilter(t *testing.T) {
 		opts       []Option
 		xcount     int
 	}{
-		{"no-options", "./testdata/multiformat", []Option{}, 9},
-		{"only-square", "./testdata/multiformat", []Option{OnlySquare}, 6},
-		{"ignore-nosize", "./testdata/multiformat", []Option{IgnoreNoSize}, 8},
+		{"no-options", "./testdata/multiformat", []Option{}, 10},
+		{"only-square", "./testdata/multiformat", []Option{OnlySquare}, 7},
+		{"ignore-nosize", "./testdata/multiformat", []Option{IgnoreNoSize}, 9},
 		{"only-ico", "./testdata/multiformat", []Option{OnlyICO}, 1},
 		{"only-png", "./testdata/multiformat", []Option{OnlyPNG}, 7},
 		{"only-square-png", "./testdata/multiformat", []Option{OnlyPNG, OnlySquare}, 4},
 		{"only-jpeg", "./testdata/multiformat", []Option{OnlyMimeType("image/jpeg")}, 1},
-		{"only-square-sized", "./testdata/multiformat", []Option{OnlySquare, IgnoreNoSize}, 5},
-		{"only-400", "./testdata/multiformat", []Option{MinWidth(400), MaxWidth(400)}, 1},
-		{"width-100-and-200", "./testdata/multiformat", []Option{MinWidth(100), MaxWidth(200)}, 4},
-		{"width+height-100-and-200", "./testdata/multiformat", []Option{MinWidth(100), MaxWidth(200), MinHeight(100), MaxHeight(200)}, 2},
+		{"only-square-sized", "./testdata/multiformat", []Option{OnlySquare, IgnoreNoSize}, 6},
+		{"only-400", "./testdata/multiformat", []Option{MinWidth(400), MaxWidth(400)}, 2},
+		{"width-100-and-200", "./testdata/multiformat", []Option{MinWidth(100), MaxWidth(200)}, 5},
+		{"width+height-100-and-200", "./testdata/multiformat", []Option{MinWidth(100), MaxWidth(200), MinHeight(100), MaxHeight(200)}, 3},
+		{"ignore-masks", "./testdata/multiformat", []Option{IgnoreMasks}, 9},
+		{"only-masks", "./testdata/multiformat", []Option{OnlyMasks}, 1},
 	}
 
 	for _, td := range tests {
@@ -218,3 +227,147 @@ func TestFilter(t *testing.T) {
 		})
 	}
 }
+
+// TestFindContext verifies that cancelling the context aborts HTTP requests.
+func TestFindContext(t *testing.T) {
+	t.Parallel()
+	var (
+		done = make(chan struct{})
+		ts   = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-done:
+			}
+		}))
+	)
+	defer ts.Close()
+	defer close(done)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	f := New(WithClient(ts.Client()), WithLogger(debugLogger{}))
+	icons, err := f.FindContext(ctx, ts.URL+"/index.html")
+	require.NotNil(t, err, "expected error")
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "unexpected error: %v", err)
+	assert.Nil(t, icons, "unexpected icons")
+
+	// cancellation also applies to the manifest and well-known requests
+	file, err := os.Open("testdata/no-markup/index.html")
+	require.Nil(t, err, "unexpected error")
+	defer file.Close()
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	icons, err = f.FindReaderContext(ctx, file, ts.URL)
+	assert.True(t, errors.Is(err, context.Canceled), "unexpected error: %v", err)
+	assert.Nil(t, icons, "unexpected icons")
+}
+
+// TestConcurrency verifies that WithConcurrency limits simultaneous requests.
+func TestConcurrency(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name        string
+		concurrency int
+		xmax        int32 // maximum expected simultaneous requests
+	}{
+		{"serial", 1, 1},
+		{"invalid", 0, 1},
+		{"concurrent", 2, 2},
+	}
+
+	for _, td := range tests {
+		td := td
+		t.Run(td.name, func(t *testing.T) {
+			t.Parallel()
+			var (
+				active, max int32
+				fs          = http.FileServer(http.Dir("./testdata/no-markup"))
+			)
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/index.html" {
+					n := atomic.AddInt32(&active, 1)
+					defer atomic.AddInt32(&active, -1)
+					for {
+						m := atomic.LoadInt32(&max)
+						if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+							break
+						}
+					}
+					time.Sleep(20 * time.Millisecond)
+				}
+				fs.ServeHTTP(w, r)
+			}))
+			defer ts.Close()
+
+			f := New(WithClient(ts.Client()), WithLogger(debugLogger{}), WithConcurrency(td.concurrency))
+			icons, err := f.Find(ts.URL + "/index.html")
+			require.Nil(t, err, "unexpected error")
+			assert.Equal(t, 3, len(icons), "unexpected favicon count")
+			assert.Equal(t, td.xmax, atomic.LoadInt32(&max), "unexpected concurrency")
+		})
+	}
+}
+
+// TestBaseElement verifies that <base href> is used to resolve links.
+func TestBaseElement(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name, html, x string
+	}{
+		{"no-base", `<link rel="icon" href="icon.png">`, "https://example.com/blog/icon.png"},
+		{"absolute", `<base href="https://cdn.example.com/app/"><link rel="icon" href="icon.png">`,
+			"https://cdn.example.com/app/icon.png"},
+		{"relative", `<base href="/static/"><link rel="icon" href="icon.png">`,
+			"https://example.com/static/icon.png"},
+		{"first-only", `<base target="_blank"><base href="/a/"><base href="/b/"><link rel="icon" href="icon.png">`,
+			"https://example.com/a/icon.png"},
+		{"meta", `<base href="https://cdn.example.com/"><meta property="og:image" content="og.png">`,
+			"https://cdn.example.com/og.png"},
+		{"javascript", `<base href="javascript:void(0)"><link rel="icon" href="icon.png">`,
+			"https://example.com/blog/icon.png"},
+	}
+
+	for _, td := range tests {
+		td := td
+		t.Run(td.name, func(t *testing.T) {
+			t.Parallel()
+			f := New(WithLogger(debugLogger{}), IgnoreManifest, IgnoreWellKnown)
+			r := strings.NewReader("<html><head>" + td.html + "</head></html>")
+			icons, err := f.FindReader(r, "https://example.com/blog/post.html")
+			require.Nil(t, err, "unexpected error")
+			require.Equal(t, 1, len(icons), "unexpected favicon count")
+			assert.Equal(t, td.x, icons[0].URL, "unexpected URL")
+		})
+	}
+
+	// default manifest is relative to <base>, but well-known paths
+	// are relative to the page
+	var (
+		mu        sync.Mutex
+		requested []string
+	)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requested = append(requested, r.Host+r.URL.Path)
+		http.NotFound(w, r)
+	})
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+	cdn := httptest.NewServer(handler)
+	defer cdn.Close()
+
+	f := New(WithLogger(debugLogger{}), WithConcurrency(1), WithWellKnownPaths("favicon.ico", "apple-touch-icon.png"))
+	r := strings.NewReader(`<html><head><base href="` + cdn.URL + `/app/"></head></html>`)
+	_, err := f.FindReader(r, ts.URL+"/blog/")
+	require.Nil(t, err, "unexpected error")
+	host := strings.TrimPrefix(ts.URL, "http://")
+	assert.Equal(t, []string{
+		strings.TrimPrefix(cdn.URL, "http://") + "/manifest.json",
+		strings.TrimPrefix(cdn.URL, "http://") + "/browserconfig.xml",
+		host + "/favicon.ico",
+		host + "/apple-touch-icon.png",
+	}, requested, "unexpected requests")
+}
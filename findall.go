@@ -0,0 +1,115 @@
+// MIT License
+//
+// Copyright (c) 2024 yulog
+
+package favicon
+
+import (
+	"context"
+	"sync"
+)
+
+// default number of URLs FindAll searches simultaneously
+const defaultFindAllConcurrency = 16
+
+// FindAllOptions configures FindAll. The zero value is valid.
+type FindAllOptions struct {
+	// Maximum number of URLs searched simultaneously. Each search makes
+	// up to the Finder's WithConcurrency requests at once. Default is 16.
+	Concurrency int
+	// Deliver results in the order of the input URLs instead of as soon
+	// as each search finishes. A slow URL then holds back the results
+	// after it, and no more than Concurrency results are pending at once.
+	Ordered bool
+}
+
+// FindAllResult is the outcome of searching one URL with FindAll.
+type FindAllResult struct {
+	Index  int     // position of URL in the input
+	URL    string  // URL passed to FindAll
+	Result *Result // nil if Err is set
+	Icons  []*Icon // same as Result.Icons
+	Err    error
+}
+
+// FindAll finds favicons for URLs. See Finder.FindAll.
+func FindAll(ctx context.Context, urls []string, opts FindAllOptions) <-chan *FindAllResult {
+	return finder.FindAll(ctx, urls, opts)
+}
+
+// FindAll finds favicons for many URLs concurrently and sends a result for
+// each URL to the returned channel, which is closed when all searches have
+// finished. All searches share the Finder's HTTP client, Cache, robots.txt
+// rules and per-host limits.
+//
+// The caller must receive from the channel until it's closed or cancel ctx.
+// If ctx is cancelled, no more searches are started, and results may be
+// dropped.
+func (f *Finder) FindAll(ctx context.Context, urls []string, opts FindAllOptions) <-chan *FindAllResult {
+	n := opts.Concurrency
+	if n < 1 {
+		n = defaultFindAllConcurrency
+	}
+
+	var (
+		out  = make(chan *FindAllResult)
+		done = make(chan *FindAllResult, n)
+		// slots are released when a result is delivered, which bounds
+		// both running searches and results pending delivery
+		sem = make(chan struct{}, n)
+	)
+
+	go func() {
+		var wg sync.WaitGroup
+	launch:
+		for i, url := range urls {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				break launch
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r := &FindAllResult{Index: i, URL: url}
+				r.Result, r.Err = f.FindDetailedContext(ctx, url)
+				if r.Result != nil {
+					r.Icons = r.Result.Icons
+				}
+				done <- r
+			}()
+		}
+		wg.Wait()
+		close(done)
+	}()
+
+	go func() {
+		defer close(out)
+		emit := func(r *FindAllResult) {
+			select {
+			case out <- r:
+			case <-ctx.Done():
+			}
+			<-sem
+		}
+
+		var (
+			pending = map[int]*FindAllResult{}
+			next    int
+		)
+		for r := range done {
+			if !opts.Ordered {
+				emit(r)
+				continue
+			}
+			pending[r.Index] = r
+			for r, ok := pending[next]; ok; r, ok = pending[next] {
+				delete(pending, next)
+				emit(r)
+				next++
+			}
+		}
+	}()
+
+	return out
+}
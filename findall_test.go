@@ -0,0 +1,89 @@
+// MIT License
+//
+// Copyright (c) 2024 yulog
+
+package favicon
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestFindAll verifies batch searches.
+func TestFindAll(t *testing.T) {
+	t.Parallel()
+	var active, peak int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&active, 1)
+		defer atomic.AddInt32(&active, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		// earlier pages are slower, so they finish last
+		i, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		time.Sleep(time.Duration(10-i) * 5 * time.Millisecond)
+		fmt.Fprintf(w, `<html><head><link rel="icon" href="/%d.png"></head></html>`, i)
+	}))
+	defer ts.Close()
+
+	var urls []string
+	for i := 0; i < 10; i++ {
+		urls = append(urls, fmt.Sprintf("%s/%d", ts.URL, i))
+	}
+	urls = append(urls, "://invalid")
+
+	f := New(WithClient(ts.Client()), WithLogger(debugLogger{}), IgnoreManifest, IgnoreWellKnown)
+	for _, ordered := range []bool{false, true} {
+		atomic.StoreInt32(&peak, 0)
+		var indexes []int
+		for r := range f.FindAll(context.Background(), urls, FindAllOptions{Concurrency: 3, Ordered: ordered}) {
+			indexes = append(indexes, r.Index)
+			assert.Equal(t, urls[r.Index], r.URL, "unexpected URL")
+			if r.Index == 10 {
+				assert.NotNil(t, r.Err, "expected error")
+				assert.Nil(t, r.Result, "unexpected result")
+				continue
+			}
+			require.Nil(t, r.Err, "unexpected error")
+			require.Equal(t, 1, len(r.Icons), "unexpected favicon count")
+			assert.Equal(t, fmt.Sprintf("%s/%d.png", ts.URL, r.Index), r.Icons[0].URL, "unexpected icon")
+		}
+		require.Equal(t, len(urls), len(indexes), "unexpected result count")
+		assert.LessOrEqual(t, atomic.LoadInt32(&peak), int32(3), "concurrency exceeded")
+		if ordered {
+			for i, n := range indexes {
+				assert.Equal(t, i, n, "results out of order")
+			}
+		} else {
+			assert.NotEqual(t, 0, indexes[0], "results not delivered as they finish")
+		}
+	}
+
+	// cancelling stops the batch
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := f.FindAll(ctx, urls, FindAllOptions{Concurrency: 1, Ordered: true})
+	<-ch
+	cancel()
+	n := 1
+	for range ch {
+		n++
+	}
+	assert.Less(t, n, len(urls), "batch not stopped")
+}
@@ -9,6 +9,7 @@ require (
 	github.com/jedib0t/go-pretty v4.3.0+incompatible
 	github.com/stretchr/testify v1.9.0
 	golang.org/x/net v0.27.0
+	golang.org/x/text v0.16.0
 )
 
 require (
@@ -0,0 +1,186 @@
+// MIT License
+//
+// Copyright (c) 2024 yulog
+
+package favicon
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// how often idle hosts are removed from a hostLimiter
+const hostSweepInterval = time.Minute
+
+// WithHostRateLimit limits the requests a Finder makes to each host to rps
+// per second on average, allowing bursts of up to burst requests. Limits
+// apply to all requests, including manifests and well-known paths, but not
+// to responses served from a Cache. Requests wait for their turn or until
+// their context is cancelled.
+func WithHostRateLimit(rps float64, burst int) Option {
+	return func(f *Finder) {
+		if burst < 1 {
+			burst = 1
+		}
+		f.hostLimits().rps = rps
+		f.hostLimits().burst = burst
+	}
+}
+
+// WithHostConcurrency limits the number of simultaneous requests a Finder
+// makes to each host. A request counts until its response body is closed.
+// Values less than 1 remove the limit.
+func WithHostConcurrency(n int) Option {
+	return func(f *Finder) {
+		f.hostLimits().maxConns = n
+	}
+}
+
+// return Finder's hostLimiter, creating it if necessary
+func (f *Finder) hostLimits() *hostLimiter {
+	if f.hosts == nil {
+		f.hosts = &hostLimiter{hosts: map[string]*hostState{}}
+	}
+	return f.hosts
+}
+
+// hostLimiter enforces per-host rate limits and connection caps.
+type hostLimiter struct {
+	rps      float64 // no rate limit if <= 0
+	burst    int
+	maxConns int // no limit if <= 0
+
+	mu        sync.Mutex
+	hosts     map[string]*hostState
+	nextSweep time.Time // when to next remove idle hosts
+}
+
+type hostState struct {
+	tokens float64   // token bucket; negative if requests are waiting
+	last   time.Time // when tokens was last updated
+	conns  chan struct{}
+	users  int // requests waiting or in progress
+}
+
+// return state for host, creating it if necessary. The caller must call
+// done when it no longer needs the state.
+func (l *hostLimiter) state(host string) *hostState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	// hosts that are idle when their requests finish are removed in done,
+	// but their buckets may still be refilling
+	if now.After(l.nextSweep) {
+		l.nextSweep = now.Add(hostSweepInterval)
+		for h, hs := range l.hosts {
+			if l.idle(hs, now) {
+				delete(l.hosts, h)
+			}
+		}
+	}
+	hs, ok := l.hosts[host]
+	if !ok {
+		hs = &hostState{tokens: float64(l.burst), last: now}
+		if l.maxConns > 0 {
+			hs.conns = make(chan struct{}, l.maxConns)
+		}
+		l.hosts[host] = hs
+	}
+	hs.users++
+	return hs
+}
+
+// release state returned by state, and remove it if host is idle
+func (l *hostLimiter) done(host string, hs *hostState) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	hs.users--
+	if l.idle(hs, time.Now()) && l.hosts[host] == hs {
+		delete(l.hosts, host)
+	}
+}
+
+// whether hs has no requests and a full bucket, i.e. is the same as new
+// state. l.mu must be held.
+func (l *hostLimiter) idle(hs *hostState, now time.Time) bool {
+	if hs.users > 0 {
+		return false
+	}
+	return l.rps <= 0 || hs.tokens+now.Sub(hs.last).Seconds()*l.rps >= float64(l.burst)
+}
+
+// wait until a request to host is permitted. The returned function must be
+// called when the request is complete.
+func (l *hostLimiter) acquire(ctx context.Context, host string) (func(), error) {
+	host = strings.ToLower(host)
+	hs := l.state(host)
+
+	release := func() { l.done(host, hs) }
+	if hs.conns != nil {
+		select {
+		case hs.conns <- struct{}{}:
+		case <-ctx.Done():
+			release()
+			return nil, ctx.Err()
+		}
+		release = func() {
+			<-hs.conns
+			l.done(host, hs)
+		}
+	}
+
+	if l.rps > 0 {
+		if err := l.wait(ctx, hs); err != nil {
+			release()
+			return nil, err
+		}
+	}
+	return release, nil
+}
+
+// take a token from host's bucket, waiting until it is available
+func (l *hostLimiter) wait(ctx context.Context, hs *hostState) error {
+	l.mu.Lock()
+	now := time.Now()
+	hs.tokens += now.Sub(hs.last).Seconds() * l.rps
+	if hs.tokens > float64(l.burst) {
+		hs.tokens = float64(l.burst)
+	}
+	hs.last = now
+	// reserve a token, going into debt if necessary
+	hs.tokens--
+	delay := time.Duration(-hs.tokens / l.rps * float64(time.Second))
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		// return unused token
+		l.mu.Lock()
+		hs.tokens++
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// calls release when the body is closed
+type releaseBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
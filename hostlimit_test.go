@@ -0,0 +1,114 @@
+// MIT License
+//
+// Copyright (c) 2024 yulog
+
+package favicon
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestHostConcurrency verifies the per-host limit on simultaneous requests.
+func TestHostConcurrency(t *testing.T) {
+	t.Parallel()
+	var active, peak int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&active, 1)
+		defer atomic.AddInt32(&active, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		if r.URL.Path == "/" {
+			_, _ = w.Write([]byte(`<html><head><link rel="manifest" href="/app.json"></head></html>`))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer ts.Close()
+
+	f := New(WithClient(ts.Client()), WithLogger(debugLogger{}), WithConcurrency(8), WithHostConcurrency(1),
+		WithWellKnownPaths("favicon.ico", "apple-touch-icon.png"))
+	res, err := f.FindDetailed(ts.URL + "/")
+	require.Nil(t, err, "unexpected error")
+	assert.Equal(t, 11, len(res.Reports), "unexpected report count")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&peak), "unexpected peak concurrency")
+}
+
+// TestHostRateLimit verifies requests are paced per host.
+func TestHostRateLimit(t *testing.T) {
+	t.Parallel()
+	l := &hostLimiter{rps: 50, burst: 2, hosts: map[string]*hostState{}}
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		release, err := l.acquire(ctx, "example.com")
+		require.Nil(t, err, "unexpected error")
+		release()
+	}
+	// 2 requests in the burst, then 3 at 20ms intervals
+	assert.GreaterOrEqual(t, time.Since(start), 55*time.Millisecond, "requests not paced")
+
+	// other hosts have their own bucket
+	start = time.Now()
+	release, err := l.acquire(ctx, "example.net")
+	require.Nil(t, err, "unexpected error")
+	release()
+	assert.Less(t, time.Since(start), 10*time.Millisecond, "other host paced")
+
+	// waiting requests are cancelled with their context
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Millisecond)
+	defer cancel()
+	l.rps = 1
+	_, err = l.acquire(ctx, "example.com")
+	assert.True(t, IsTimeout(err), "expected timeout, got %v", err)
+}
+
+// TestHostLimiterIdle verifies that idle hosts are removed.
+func TestHostLimiterIdle(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	count := func(l *hostLimiter) int {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return len(l.hosts)
+	}
+
+	// hosts are removed as soon as their requests are done
+	l := &hostLimiter{maxConns: 1, hosts: map[string]*hostState{}}
+	release, err := l.acquire(ctx, "example.com")
+	require.Nil(t, err, "unexpected error")
+	assert.Equal(t, 1, count(l), "unexpected host count")
+	release()
+	assert.Equal(t, 0, count(l), "idle host not removed")
+
+	// ...or once their buckets are full again
+	l = &hostLimiter{rps: 100, burst: 1, hosts: map[string]*hostState{}}
+	release, err = l.acquire(ctx, "example.com")
+	require.Nil(t, err, "unexpected error")
+	release()
+	assert.Equal(t, 1, count(l), "host with empty bucket removed")
+	time.Sleep(20 * time.Millisecond)
+	l.mu.Lock()
+	l.nextSweep = time.Time{}
+	l.mu.Unlock()
+	release, err = l.acquire(ctx, "example.net")
+	require.Nil(t, err, "unexpected error")
+	l.mu.Lock()
+	_, ok := l.hosts["example.com"]
+	l.mu.Unlock()
+	assert.False(t, ok, "idle host not removed")
+	release()
+}
@@ -9,78 +9,124 @@
 package favicon
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	urls "net/url"
 	"path/filepath"
 	"strings"
+	"time"
 
 	gq "github.com/PuerkitoBio/goquery"
 	"golang.org/x/net/html"
 )
 
 // entry point for URLs
-func (p *parser) parseURL(url string) ([]*Icon, error) {
+func (p *parser) parseURL(ctx context.Context, url string) (*Result, error) {
 	u, err := urls.Parse(url)
 	if err != nil {
 		return nil, fmt.Errorf("invalid URL: %w", err)
 	}
 	p.baseURL = u
 
-	rc, err := p.find.fetchURL(url)
+	resp, err := p.find.fetch(ctx, url)
 	if err != nil {
 		return nil, fmt.Errorf("fetch page: %w", err)
 	}
-	defer rc.Close()
-
-	doc, err := gq.NewDocumentFromReader(rc)
+	// read the whole page now to free the connection for other requests
+	// to the host, e.g. the manifest
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
 	if err != nil {
-		return nil, fmt.Errorf("parse HTML: %w", err)
+		return nil, fmt.Errorf("read page: %w", err)
+	}
+
+	// resolve links against the URL the page was actually retrieved from
+	p.baseURL = resp.Request.URL
+	p.redirects = redirectChain(resp)
+	if p.find.cache != nil {
+		p.expires, _ = p.find.cacheExpiry(resp.Header, time.Now())
+	}
+
+	return p.parseReaderContentType(ctx, bytes.NewReader(body), resp.Header.Get("Content-Type"))
+}
+
+// return the URLs requested before the one that returned resp, i.e. the
+// URLs that were redirected, in the order they were requested.
+func redirectChain(resp *http.Response) []string {
+	var urls []string
+	for req := resp.Request; req.Response != nil; req = req.Response.Request {
+		urls = append([]string{req.Response.Request.URL.String()}, urls...)
 	}
-	return p.parse(doc)
+	return urls
 }
 
 // entry point for io.Reader
-func (p *parser) parseReader(r io.Reader) ([]*Icon, error) {
+func (p *parser) parseReader(ctx context.Context, r io.Reader) (*Result, error) {
+	return p.parseReaderContentType(ctx, r, "")
+}
+
+// decode HTML read from r to UTF-8 and parse it. The encoding is determined
+// from the BOM, contentType (which may be empty) and <meta> tags.
+func (p *parser) parseReaderContentType(ctx context.Context, r io.Reader, contentType string) (*Result, error) {
+	r, err := p.decodeReader(r, contentType)
+	if err != nil {
+		return nil, fmt.Errorf("detect charset: %w", err)
+	}
 	doc, err := gq.NewDocumentFromReader(r)
 	if err != nil {
 		return nil, fmt.Errorf("parse HTML: %w", err)
 	}
-	return p.parse(doc)
+	return p.parse(ctx, doc)
 }
 
 // entry point for html.Node
-func (p *parser) parseNode(n *html.Node) ([]*Icon, error) {
+func (p *parser) parseNode(ctx context.Context, n *html.Node) (*Result, error) {
 	doc := gq.NewDocumentFromNode(n)
-	return p.parse(doc)
+	return p.parse(ctx, doc)
 }
 
 // entry point for gq.Document
-func (p *parser) parseGoQueryDocument(doc *gq.Document) ([]*Icon, error) {
-	return p.parse(doc)
+func (p *parser) parseGoQueryDocument(ctx context.Context, doc *gq.Document) (*Result, error) {
+	return p.parse(ctx, doc)
 }
 
 // main parser function
-func (p *parser) parse(doc *gq.Document) ([]*Icon, error) {
+func (p *parser) parse(ctx context.Context, doc *gq.Document) (*Result, error) {
+	// a <base href> sets the URL relative links are resolved against
+	if href, ok := doc.Find("base[href]").First().Attr("href"); ok {
+		if u, err := urls.Parse(p.absURL(strings.TrimSpace(href))); err == nil &&
+			u.Scheme != "data" && u.Scheme != "javascript" {
+			p.docBaseURL = u
+		}
+	}
+
 	var (
 		icons       []*Icon
+		links       []*Icon
+		res         = &Result{}
 		manifestURL = p.absURL("/manifest.json")
 	)
 
 	// icons described in <link../> tags
 	doc.Find("link").Each(func(i int, sel *gq.Selection) {
 		rel, _ := sel.Attr("rel")
-		rel = strings.ToLower(rel)
-		switch rel {
+		tokens := relTokens(rel)
+		switch {
+		// Safari pinned tabs
+		case tokens["mask-icon"]:
+			links = append(links, p.parseMaskIcon(sel)...)
 		// all cases are handled the same way for now
-		case "icon", "alternate icon", "shortcut icon":
-			icons = append(icons, p.parseLink(sel)...)
-		case "apple-touch-icon", "apple-touch-icon-precomposed":
-			icons = append(icons, p.parseLink(sel)...)
-		// site-specific browser apps (https://fluidapp.com/)
-		case "fluid-icon":
-			icons = append(icons, p.parseLink(sel)...)
-		case "manifest":
+		case tokens["icon"],
+			tokens["apple-touch-icon"], tokens["apple-touch-icon-precomposed"],
+			// site-specific browser apps (https://fluidapp.com/)
+			tokens["fluid-icon"]:
+			links = append(links, p.parseLink(sel)...)
+		}
+		if tokens["manifest"] {
 			url, _ := sel.Attr("href")
 			url = p.absURL(url)
 			if url != "" {
@@ -89,15 +135,18 @@ func (p *parser) parse(doc *gq.Document) ([]*Icon, error) {
 		}
 	})
 
-	// OpenGraph (og:) and Twitter <meta../> tags
+	// OpenGraph (og:), Twitter and msapplication-* <meta../> tags
 	var (
-		// k, v, k, v sequences
-		opengraph []string
-		twitter   []string
+		opengraph []metaTag
+		twitter   []metaTag
+		msapp     []metaTag
 	)
 	doc.Find("meta").Each(func(i int, sel *gq.Selection) {
+		// charset of already-parsed documents, e.g. from FindNode
 		if s, ok := sel.Attr("charset"); ok && s != "" {
-			p.charset = s
+			if p.charset == "" {
+				p.charset = strings.ToLower(s)
+			}
 			return
 		}
 
@@ -117,39 +166,173 @@ func (p *parser) parse(doc *gq.Document) ([]*Icon, error) {
 
 		prop = strings.ToLower(prop)
 		if strings.HasPrefix(prop, "og:image") {
-			opengraph = append(opengraph, prop, val)
+			opengraph = append(opengraph, newMetaTag(sel, prop, val))
 		}
-		if strings.HasPrefix(prop, "twitter:image") {
-			twitter = append(twitter, prop, val)
+		if strings.HasPrefix(prop, "twitter:image") || prop == "twitter:card" {
+			twitter = append(twitter, newMetaTag(sel, prop, val))
+		}
+		if strings.HasPrefix(prop, msPrefix) {
+			msapp = append(msapp, newMetaTag(sel, prop, val))
 		}
 	})
 
-	// find icons in k, v sequences
-	icons = append(icons, p.parseOpenGraph(opengraph)...)
-	icons = append(icons, p.parseTwitter(twitter)...)
+	// find icons in <meta../> sequences
+	var (
+		og            = p.parseOpenGraph(opengraph)
+		tw, card      = p.parseTwitter(twitter)
+		ms, configURL = p.parseMSApplication(msapp)
+	)
+	p.inheritMimeTypes(tw, og)
+	// schema.org logos in JSON-LD and microdata
+	var ld, md []*Icon
+	if !p.find.ignoreStructuredData {
+		ld, md = p.parseJSONLD(doc), p.parseMicrodata(doc)
+	}
+	// logo and photo of the page's h-card
+	var mf []*Icon
+	if !p.find.ignoreMicroformats {
+		mf = p.parseMicroformats(doc)
+	}
+	// Twitter uses og:image for cards without a twitter:image
+	if len(tw) == 0 {
+		for _, icon := range og {
+			icon.TwitterCard = card
+		}
+	}
+	res.Reports = append(res.Reports,
+		&SourceReport{Source: SourceLink, Count: len(links)},
+		&SourceReport{Source: SourceOpenGraph, Count: len(og)},
+		&SourceReport{Source: SourceTwitter, Count: len(tw)},
+		&SourceReport{Source: SourceMSApplication, Count: len(ms)},
+	)
+	if !p.find.ignoreStructuredData {
+		res.Reports = append(res.Reports,
+			&SourceReport{Source: SourceJSONLD, Count: len(ld)},
+			&SourceReport{Source: SourceMicrodata, Count: len(md)},
+		)
+	}
+	if !p.find.ignoreMicroformats {
+		res.Reports = append(res.Reports, &SourceReport{Source: SourceMicroformats, Count: len(mf)})
+	}
+	icons = append(icons, links...)
+	icons = append(icons, og...)
+	icons = append(icons, tw...)
+	icons = append(icons, ms...)
+	icons = append(icons, ld...)
+	icons = append(icons, md...)
+	icons = append(icons, mf...)
 
+	// remote sources are retrieved concurrently; results are merged
+	// in the order the tasks were added.
+	var tasks []task
 	// retrieve and parse JSON manifest
 	if !p.find.ignoreManifest {
-		icons = append(icons, p.parseManifest(manifestURL)...)
+		tasks = append(tasks, task{SourceManifest, manifestURL, p.parseManifest})
+	}
+	// retrieve and parse browserconfig.xml unless the page disables it
+	if !p.find.ignoreBrowserConfig && configURL != "none" {
+		if configURL == "" {
+			configURL = p.absURL("/browserconfig.xml")
+		}
+		if configURL != "" {
+			tasks = append(tasks, task{SourceBrowserConfig, configURL, p.parseBrowserConfig})
+		}
 	}
 	// check for existence of URLs like /favicon.ico
 	if !p.find.ignoreWellKnown {
-		icons = append(icons, p.findWellKnownIcons()...)
+		for _, u := range p.wellKnownURLs() {
+			tasks = append(tasks, task{SourceWellKnown, u, p.findWellKnownIcon})
+		}
 	}
 
-	icons = p.postProcessIcons(icons)
+	var (
+		reports = make([]*SourceReport, len(tasks))
+		results = make([][]*Icon, len(tasks))
+	)
+	p.find.parallel(len(tasks), func(i int) {
+		t := tasks[i]
+		v, err := t.run(ctx, t.url)
+		reports[i] = &SourceReport{Source: t.source, URL: t.url, Count: len(v), Err: err}
+		if errors.Is(err, ErrDisallowed) {
+			reports[i].Err, reports[i].Skipped = nil, true
+		}
+		results[i] = v
+	})
+	for i, v := range results {
+		icons = append(icons, v...)
+		res.Reports = append(res.Reports, reports[i])
+	}
+
+	// don't return partial results if the search was cancelled
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	res.Icons = p.postProcessIcons(ctx, icons)
+	if p.find.separateSocialImages {
+		res.Icons, res.SocialImages = splitSocialImages(res.Icons)
+	}
+	res.Charset = p.charset
+	res.Redirects = p.redirects
+	if p.baseURL != nil {
+		res.URL = p.baseURL.String()
+	}
+
+	return res, nil
+}
 
-	return icons, nil
+// a remote source of icons
+type task struct {
+	source Source
+	url    string
+	run    func(ctx context.Context, url string) ([]*Icon, error)
+}
+
+// split a rel attribute into its lowercase, space-separated keywords
+func relTokens(rel string) map[string]bool {
+	tokens := map[string]bool{}
+	for _, s := range strings.Fields(strings.ToLower(rel)) {
+		tokens[s] = true
+	}
+	return tokens
+}
+
+// extract a Safari pinned-tab icon, a monochrome SVG filled with the
+// colour in its color attribute
+func (p *parser) parseMaskIcon(sel *gq.Selection) []*Icon {
+	color, _ := sel.Attr("color")
+	icons := p.parseLink(sel)
+	for _, icon := range icons {
+		icon.Mask, icon.Scalable = true, true
+		icon.Kind = KindFavicon
+		icon.Color = strings.TrimSpace(color)
+		if icon.MimeType == "" {
+			icon.MimeType = mimeSVG
+		}
+	}
+	return icons
+}
+
+// property and content of a <meta../> tag
+type metaTag struct {
+	prop, val string
+	origin    string // HTML of tag
+}
+
+func newMetaTag(sel *gq.Selection, prop, val string) metaTag {
+	return metaTag{prop: prop, val: val, origin: outerHTML(sel)}
 }
 
 // extract icons defined in <link../> tags
 func (p *parser) parseLink(sel *gq.Selection) []*Icon {
 	var (
-		href, _ = sel.Attr("href")
-		typ, _  = sel.Attr("type")
-		size, _ = sel.Attr("sizes")
-		icons   []*Icon
-		icon    = &Icon{}
+		href, _  = sel.Attr("href")
+		typ, _   = sel.Attr("type")
+		size, _  = sel.Attr("sizes")
+		rel, _   = sel.Attr("rel")
+		media, _ = sel.Attr("media")
+		icons    []*Icon
+		icon     = &Icon{}
 	)
 
 	if href = p.absURL(href); href == "" {
@@ -157,6 +340,9 @@ func (p *parser) parseLink(sel *gq.Selection) []*Icon {
 	}
 
 	icon.URL = href
+	icon.Media = strings.TrimSpace(media)
+	icon.Kind = linkKind(relTokens(rel))
+	icon.addProvenance(Provenance{Source: SourceLink, Rel: rel, Origin: outerHTML(sel)})
 	// icon.FileExt = fileExt(href)
 	if typ != "" {
 		icon.MimeType = typ
@@ -164,7 +350,7 @@ func (p *parser) parseLink(sel *gq.Selection) []*Icon {
 	if size != "" {
 		for _, sz := range parseSizes(size) {
 			i := icon.Copy()
-			i.Width, i.Height = sz.w, sz.h
+			i.Width, i.Height, i.Scalable = sz.w, sz.h, sz.any
 			icons = append(icons, i)
 		}
 	}
@@ -176,6 +362,12 @@ func (p *parser) parseLink(sel *gq.Selection) []*Icon {
 	return icons
 }
 
+// return HTML of selected element
+func outerHTML(sel *gq.Selection) string {
+	s, _ := gq.OuterHtml(sel)
+	return s
+}
+
 // extract file extension from a URL
 func fileExt(url string) string {
 	u, err := urls.Parse(url)
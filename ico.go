@@ -0,0 +1,226 @@
+// MIT License
+//
+// Copyright (c) 2024 yulog
+
+package favicon
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maximum size of ICO file downloaded by ExpandICO
+const maxICOSize = 4 << 20
+
+// Encodings of images embedded in ICO files.
+const (
+	ICOFormatPNG = "png"
+	ICOFormatBMP = "bmp"
+)
+
+// ICOImage describes one of the images in an ICO file.
+type ICOImage struct {
+	Index    int    `json:"index"`    // position in ICO directory
+	Width    int    `json:"width"`    // width in pixels
+	Height   int    `json:"height"`   // height in pixels
+	BitDepth int    `json:"bitdepth"` // bits per pixel; 0 if unknown
+	Format   string `json:"format"`   // ICOFormatPNG or ICOFormatBMP
+	Offset   int    `json:"-"`        // offset of image data in file
+	Size     int    `json:"-"`        // length of image data
+}
+
+// ParseICO reads the directory of an ICO file and returns its images.
+// Dimensions and bit depth are read from the embedded images where possible,
+// as ICO directories are often inaccurate, e.g. 0 for 256-pixel images.
+// Images whose data is missing from data are described by the directory only.
+func ParseICO(data []byte) ([]ICOImage, error) {
+	if len(data) < 6 || !bytes.HasPrefix(data, []byte("\x00\x00\x01\x00")) {
+		return nil, errors.New("ico: invalid header")
+	}
+
+	n := int(binary.LittleEndian.Uint16(data[4:6]))
+	if 6+n*16 > len(data) {
+		return nil, errors.New("ico: truncated directory")
+	}
+	images := make([]ICOImage, 0, n)
+	for i := 0; i < n; i++ {
+		off := 6 + i*16
+		entry := data[off : off+16]
+		img := ICOImage{
+			Index:    i,
+			Width:    int(entry[0]),
+			Height:   int(entry[1]),
+			BitDepth: int(binary.LittleEndian.Uint16(entry[6:8])),
+			Format:   ICOFormatBMP,
+			Size:     int(binary.LittleEndian.Uint32(entry[8:12])),
+			Offset:   int(binary.LittleEndian.Uint32(entry[12:16])),
+		}
+		// 0 means 256 pixels
+		if img.Width == 0 {
+			img.Width = 256
+		}
+		if img.Height == 0 {
+			img.Height = 256
+		}
+		readICOImageHeader(data, &img)
+		images = append(images, img)
+	}
+	return images, nil
+}
+
+// update ICOImage with values from embedded image's header
+func readICOImageHeader(data []byte, img *ICOImage) {
+	if img.Offset < 0 || img.Offset >= len(data) {
+		return
+	}
+	b := data[img.Offset:]
+
+	if bytes.HasPrefix(b, []byte("\x89PNG\r\n\x1a\n")) {
+		img.Format = ICOFormatPNG
+		if len(b) < 26 {
+			return
+		}
+		// IHDR chunk: width, height, bit depth, colour type
+		img.Width = int(binary.BigEndian.Uint32(b[16:20]))
+		img.Height = int(binary.BigEndian.Uint32(b[20:24]))
+		// samples per pixel for each colour type
+		channels := map[byte]int{0: 1, 2: 3, 3: 1, 4: 2, 6: 4}[b[25]]
+		img.BitDepth = int(b[24]) * channels
+		return
+	}
+
+	// BITMAPINFOHEADER; height includes AND mask, so is doubled
+	if len(b) < 16 || binary.LittleEndian.Uint32(b[0:4]) < 16 {
+		return
+	}
+	img.Width = int(int32(binary.LittleEndian.Uint32(b[4:8])))
+	img.Height = int(int32(binary.LittleEndian.Uint32(b[8:12]))) / 2
+	if img.Height < 0 {
+		img.Height = -img.Height
+	}
+	img.BitDepth = int(binary.LittleEndian.Uint16(b[14:16]))
+}
+
+// ExtractICOImage returns the image at index in an ICO file as a standalone
+// PNG or BMP file, depending on the embedded image's format.
+func ExtractICOImage(data []byte, index int) ([]byte, error) {
+	images, err := ParseICO(data)
+	if err != nil {
+		return nil, err
+	}
+	if index < 0 || index >= len(images) {
+		return nil, fmt.Errorf("ico: no image %d", index)
+	}
+
+	img := images[index]
+	// bounds are checked without overflowing on 32-bit platforms
+	if img.Offset < 0 || img.Size <= 0 || img.Offset > len(data)-img.Size {
+		return nil, fmt.Errorf("ico: image %d: truncated data", index)
+	}
+	b := data[img.Offset : img.Offset+img.Size]
+	if img.Format == ICOFormatPNG {
+		return append([]byte(nil), b...), nil
+	}
+	return icoBMPToFile(b)
+}
+
+// convert a BMP embedded in an ICO file to a BMP file by adding a file
+// header and removing the AND mask from the image height.
+func icoBMPToFile(dib []byte) ([]byte, error) {
+	if len(dib) < 40 {
+		return nil, errors.New("ico: invalid bitmap header")
+	}
+	var (
+		headerSize = binary.LittleEndian.Uint32(dib[0:4])
+		height     = int32(binary.LittleEndian.Uint32(dib[8:12]))
+		bitCount   = binary.LittleEndian.Uint16(dib[14:16])
+		colours    = binary.LittleEndian.Uint32(dib[32:36])
+	)
+	if colours == 0 && bitCount <= 8 {
+		colours = 1 << bitCount
+	}
+
+	buf := make([]byte, 14+len(dib))
+	copy(buf, "BM")
+	binary.LittleEndian.PutUint32(buf[2:6], uint32(len(buf)))
+	binary.LittleEndian.PutUint32(buf[10:14], 14+headerSize+colours*4)
+	copy(buf[14:], dib)
+	binary.LittleEndian.PutUint32(buf[22:26], uint32(height/2))
+	return buf, nil
+}
+
+// ExpandICO replaces each ICO file with an Icon for each image it contains.
+// ICO files are downloaded to read their contents, and expanded Icons have
+// their ICO field set. ICO files that cannot be retrieved are left as-is.
+var ExpandICO Option = func(f *Finder) { f.expandICO = true }
+
+// replace ICO icons with an icon for each embedded image
+func (f *Finder) expandICOIcons(ctx context.Context, icons []*Icon) []*Icon {
+	var (
+		urls  []string
+		byURL = map[string][]*Icon{}
+		other []*Icon
+	)
+	for _, icon := range icons {
+		if !sameMimeType(icon.MimeType, mimeICO) {
+			other = append(other, icon)
+			continue
+		}
+		if _, ok := byURL[icon.URL]; !ok {
+			urls = append(urls, icon.URL)
+		}
+		byURL[icon.URL] = append(byURL[icon.URL], icon)
+	}
+
+	expanded := make([][]*Icon, len(urls))
+	f.parallel(len(urls), func(i int) {
+		var (
+			url  = urls[i]
+			orig = byURL[url]
+		)
+		images, err := f.readICO(ctx, url)
+		if err != nil || len(images) == 0 {
+			f.log.Printf("[ERROR] expand ICO %s: %v", url, err)
+			expanded[i] = orig
+			return
+		}
+
+		// merge provenance of all icons with this URL
+		tmpl := orig[0].Copy()
+		for _, icon := range orig[1:] {
+			for _, pr := range icon.Provenance {
+				tmpl.addProvenance(pr)
+			}
+		}
+		for _, img := range images {
+			icon := tmpl.Copy()
+			icon.Width, icon.Height = img.Width, img.Height
+			icon.ICO = &img
+			expanded[i] = append(expanded[i], icon)
+		}
+	})
+
+	for _, v := range expanded {
+		other = append(other, v...)
+	}
+	return other
+}
+
+// retrieve ICO file and parse its directory
+func (f *Finder) readICO(ctx context.Context, url string) ([]ICOImage, error) {
+	rc, err := f.fetchURL(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, maxICOSize))
+	if err != nil {
+		return nil, fmt.Errorf("read ICO: %w", err)
+	}
+	return ParseICO(data)
+}
@@ -0,0 +1,117 @@
+// MIT License
+//
+// Copyright (c) 2024 yulog
+
+package favicon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// build an ICO file containing the given PNG files
+func makeICO(pngs ...[]byte) []byte {
+	var (
+		buf    bytes.Buffer
+		offset = 6 + 16*len(pngs)
+	)
+	buf.Write([]byte{0, 0, 1, 0})
+	_ = binary.Write(&buf, binary.LittleEndian, uint16(len(pngs)))
+	for _, b := range pngs {
+		// directory sizes are deliberately wrong (0 = 256)
+		buf.Write([]byte{0, 0, 0, 0, 1, 0, 32, 0})
+		_ = binary.Write(&buf, binary.LittleEndian, uint32(len(b)))
+		_ = binary.Write(&buf, binary.LittleEndian, uint32(offset))
+		offset += len(b)
+	}
+	for _, b := range pngs {
+		buf.Write(b)
+	}
+	return buf.Bytes()
+}
+
+// TestParseICO verifies reading of ICO directories.
+func TestParseICO(t *testing.T) {
+	t.Parallel()
+	data, err := os.ReadFile("testdata/multisize/favicon.ico")
+	require.Nil(t, err, "unexpected error")
+
+	images, err := ParseICO(data)
+	require.Nil(t, err, "unexpected error")
+	require.Equal(t, 3, len(images), "unexpected image count")
+	for i, x := range []int{16, 32, 48} {
+		img := images[i]
+		assert.Equal(t, i, img.Index, "unexpected index")
+		assert.Equal(t, x, img.Width, "unexpected width")
+		assert.Equal(t, x, img.Height, "unexpected height")
+		assert.Equal(t, 32, img.BitDepth, "unexpected bit depth")
+		assert.Equal(t, ICOFormatBMP, img.Format, "unexpected format")
+
+		// extracted bitmaps are standalone BMP files
+		b, err := ExtractICOImage(data, i)
+		require.Nil(t, err, "unexpected error")
+		info, err := readImageInfo(b)
+		require.Nil(t, err, "unexpected error")
+		assert.Equal(t, "image/bmp", info.mimeType, "unexpected MIME type")
+		assert.Equal(t, x, info.width, "unexpected width")
+		assert.Equal(t, x, info.height, "unexpected height")
+	}
+
+	// PNG images
+	png := encodeImage(t, "png", 64, 64)
+	data = makeICO(encodeImage(t, "png", 128, 128), png)
+	images, err = ParseICO(data)
+	require.Nil(t, err, "unexpected error")
+	require.Equal(t, 2, len(images), "unexpected image count")
+	assert.Equal(t, 128, images[0].Width, "unexpected width")
+	assert.Equal(t, 64, images[1].Height, "unexpected height")
+	assert.Equal(t, ICOFormatPNG, images[1].Format, "unexpected format")
+	assert.Equal(t, 32, images[1].BitDepth, "unexpected bit depth")
+
+	b, err := ExtractICOImage(data, 1)
+	require.Nil(t, err, "unexpected error")
+	assert.Equal(t, png, b, "unexpected PNG data")
+
+	_, err = ExtractICOImage(data, 2)
+	assert.NotNil(t, err, "expected error")
+	// out-of-range sizes in the directory
+	for _, size := range []uint32{0, 0xffffffff} {
+		bad := append([]byte(nil), data...)
+		binary.LittleEndian.PutUint32(bad[6+16+8:], size)
+		_, err = ExtractICOImage(bad, 1)
+		assert.NotNil(t, err, "expected error for size %d", size)
+	}
+	_, err = ParseICO([]byte("GIF89a"))
+	assert.NotNil(t, err, "expected error")
+	// directory larger than the file
+	_, err = ParseICO([]byte("\x00\x00\x01\x00\xff\xff"))
+	assert.NotNil(t, err, "expected error for truncated directory")
+}
+
+// TestExpandICO verifies expansion of ICO files into their images.
+func TestExpandICO(t *testing.T) {
+	t.Parallel()
+	ts := httptest.NewServer(http.FileServer(http.Dir("./testdata/multisize")))
+	defer ts.Close()
+
+	f := New(WithClient(ts.Client()), WithLogger(debugLogger{}), ExpandICO, MinWidth(32))
+	icons, err := f.Find(ts.URL + "/index.html")
+	require.Nil(t, err, "unexpected error")
+	// declared sizes (48x48 24x24 16x16) are replaced by real ones
+	require.Equal(t, 2, len(icons), "unexpected favicon count")
+	for i, x := range []int{48, 32} {
+		icon := icons[i]
+		assert.Equal(t, x, icon.Width, "unexpected width")
+		require.NotNil(t, icon.ICO, "ICO image not set")
+		assert.Equal(t, 2-i, icon.ICO.Index, "unexpected index")
+		// provenance of /favicon.ico in <link> and at well-known path
+		assert.Equal(t, 2, len(icon.Provenance), "unexpected provenance")
+	}
+}
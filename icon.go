@@ -9,14 +9,16 @@
 package favicon
 
 import (
+	"context"
 	"crypto/sha256"
 	"fmt"
+	"regexp"
 	"sort"
+	"strings"
 )
 
 // Icon is a favicon parsed from an HTML file or JSON manifest.
-//
-// TODO: Use *Icon everywhere to be consistent with higher-level APIs that return nil for "not found".
+// Higher-level APIs, such as Best(), return nil for "not found".
 type Icon struct {
 	URL      string `json:"url"`       // Never empty
 	MimeType string `json:"mimetype"`  // MIME type of icon; never empty
@@ -25,33 +27,153 @@ type Icon struct {
 	// searching for numbers in the URL.
 	Width  int `json:"width"`
 	Height int `json:"height"`
+	// Scalable is true for vector icons, i.e. SVGs and icons declared
+	// with sizes="any", which may be rendered at any size. Their Width
+	// and Height, if set, are their intrinsic dimensions.
+	Scalable bool `json:"scalable"`
+	// Purposes of manifest icons, e.g. "any" or "maskable". Empty for
+	// icons from other sources.
+	Purpose []string `json:"purpose,omitempty"`
+	// Color associated with the icon, e.g. the background of a Windows
+	// tile ("#2b5797") or the fill of a mask. Empty if none was declared.
+	Color string `json:"color,omitempty"`
+	// Media query from the media attribute of <link> tags, e.g.
+	// "(prefers-color-scheme: dark)". Empty if the icon applies to all
+	// media. See ColorScheme.
+	Media string `json:"media,omitempty"`
+	// Mask is true for monochrome icons that are only a shape to be
+	// filled with Color, e.g. Safari pinned-tab icons (<link
+	// rel="mask-icon">). They aren't suitable as full-colour favicons and
+	// are sorted after other icons. See IgnoreMasks and OnlyMasks.
+	Mask bool `json:"mask,omitempty"`
+	// Alternative text of social images, from og:image:alt or
+	// twitter:image:alt. Empty for other icons.
+	Alt string `json:"alt,omitempty"`
+	// Type of Twitter card that displays the image, e.g.
+	// TwitterCardSummary. Empty if the page doesn't declare a
+	// twitter:card or the image isn't used by it.
+	TwitterCard string `json:"twitter_card,omitempty"`
+	// What the icon is meant for, e.g. KindFavicon or KindSocialImage.
+	Kind Kind `json:"kind"`
 	// Hash of URL and dimensions to uniquely identify icon.
 	Hash string `json:"hash"`
+	// Source and rel attribute (or <meta> property) of the first place
+	// the icon was found. See Provenance for all places.
+	Source Source `json:"source"`
+	Rel    string `json:"rel,omitempty"`
+	// Every place the icon was found, in the order the sources were
+	// searched. Duplicate icons are merged, so an icon may have
+	// several entries.
+	Provenance []Provenance `json:"provenance,omitempty"`
+	// Result of downloading the icon to check its format and size.
+	// Nil if the icon hasn't been verified. See Finder.Verify().
+	Verification *Verification `json:"verification,omitempty"`
+	// Image within ICO file described by this Icon. Only set when
+	// ICO files are expanded. See ExpandICO.
+	ICO *ICOImage `json:"ico,omitempty"`
+}
+
+// Provenance describes where an Icon was found.
+type Provenance struct {
+	Source Source `json:"source"`
+	// Value of rel attribute for <link> tags or property for <meta> tags.
+	Rel string `json:"rel,omitempty"`
+	// HTML of the element that defined the icon or, for remote sources,
+	// the URL of the manifest or well-known path.
+	Origin string `json:"origin,omitempty"`
 }
 
 // String implements Stringer.
 func (i Icon) String() string {
-	return fmt.Sprintf("Icon{\n\tURL: %q,\n\tMimeType: %q,\n\tWidth: %d,\n\tHeight: %d,\n\tHash: %q\n}",
-		i.URL, i.MimeType, i.Width, i.Height, i.Hash)
+	return fmt.Sprintf("Icon{\n\tURL: %q,\n\tMimeType: %q,\n\tWidth: %d,\n\tHeight: %d,\n\tHash: %q,\n\tSource: %q\n}",
+		i.URL, i.MimeType, i.Width, i.Height, i.Hash, i.Source)
 }
 
 // IsSquare returns true if image has equally-long sides.
 func (i Icon) IsSquare() bool { return i.Width == i.Height }
 
+// Colour schemes returned by Icon.ColorScheme.
+const (
+	ColorSchemeLight = "light"
+	ColorSchemeDark  = "dark"
+)
+
+var rxColorScheme = regexp.MustCompile(`(?i)^(not\s+)?\(\s*prefers-color-scheme\s*:\s*(light|dark)\s*\)$`)
+
+// ColorScheme returns the colour scheme the icon is meant for, i.e.
+// ColorSchemeLight or ColorSchemeDark, as declared by a media query like
+// "(prefers-color-scheme: dark)". It returns "" if the icon applies to any
+// colour scheme or the query is too complex to interpret.
+func (i Icon) ColorScheme() string {
+	m := rxColorScheme.FindStringSubmatch(strings.TrimSpace(i.Media))
+	if m == nil {
+		return ""
+	}
+	scheme := strings.ToLower(m[2])
+	if m[1] != "" { // "not (...)"
+		if scheme == ColorSchemeDark {
+			return ColorSchemeLight
+		}
+		return ColorSchemeDark
+	}
+	return scheme
+}
+
 // Copy returns a new Icon with the same values as this one.
 func (i Icon) Copy() *Icon {
+	var (
+		v   *Verification
+		ico *ICOImage
+	)
+	if i.Verification != nil {
+		c := *i.Verification
+		v = &c
+	}
+	if i.ICO != nil {
+		c := *i.ICO
+		ico = &c
+	}
 	return &Icon{
-		URL:      i.URL,
-		MimeType: i.MimeType,
-		FileExt:  i.FileExt,
-		Width:    i.Width,
-		Height:   i.Height,
-		Hash:     i.Hash,
+		URL:         i.URL,
+		MimeType:    i.MimeType,
+		FileExt:     i.FileExt,
+		Width:       i.Width,
+		Height:      i.Height,
+		Scalable:    i.Scalable,
+		Purpose:     append([]string(nil), i.Purpose...),
+		Color:       i.Color,
+		Media:       i.Media,
+		Mask:        i.Mask,
+		Alt:         i.Alt,
+		TwitterCard: i.TwitterCard,
+		Kind:        i.Kind,
+		Hash:        i.Hash,
+		Source:      i.Source,
+		Rel:         i.Rel,
+		// copy slices, so appending to one Icon's doesn't change another's
+		Provenance:   append([]Provenance(nil), i.Provenance...),
+		Verification: v,
+		ICO:          ico,
+	}
+}
+
+// record that Icon was found in a source
+func (i *Icon) addProvenance(pr Provenance) {
+	for _, v := range i.Provenance {
+		if v == pr {
+			return
+		}
 	}
+	if len(i.Provenance) == 0 {
+		i.Source, i.Rel = pr.Source, pr.Rel
+	}
+	i.Provenance = append(i.Provenance, pr)
 }
 
 // ByWidth sorts icons by width (largest first), and then by image type
-// (PNG > JPEG > SVG > ICO).
+// (PNG > JPEG > SVG > ICO). Scalable icons are considered larger than
+// all others. Masks come after other icons, and logos and social images
+// last.
 type ByWidth []*Icon
 
 // Implement sort.Interface
@@ -63,13 +185,20 @@ func (v ByWidth) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
 var formatRank = map[string]int{
 	"image/png":                10,
 	"image/jpeg":               9,
-	"image/svg":                8,
+	"image/svg+xml":            8,
+	"image/svg":                8, // non-standard
 	"image/x-icon":             7, // .ico
 	"image/vnd.microsoft.icon": 7, // .ico
 }
 
 func (v ByWidth) Less(i, j int) bool {
 	a, b := v[i], v[j]
+	if ga, gb := sortGroup(a), sortGroup(b); ga != gb {
+		return ga < gb
+	}
+	if a.Scalable != b.Scalable {
+		return a.Scalable
+	}
 	if a.Width != b.Width {
 		return a.Width > b.Width
 	}
@@ -80,9 +209,23 @@ func (v ByWidth) Less(i, j int) bool {
 	return a.URL < b.URL
 }
 
-// Check missing values, remove duplicates, sort.
-func (p *parser) postProcessIcons(icons []*Icon) []*Icon {
-	tidied := map[string]*Icon{}
+// return the group an icon is sorted in: icons that can be used as they
+// are, then masks, then images that aren't icons, i.e. logos and social
+// images
+func sortGroup(icon *Icon) int {
+	switch {
+	case icon.Kind == KindSocialImage, icon.Kind == KindLogo:
+		return 2
+	case icon.Mask:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Check missing values, verify, remove duplicates, sort.
+func (p *parser) postProcessIcons(ctx context.Context, icons []*Icon) []*Icon {
+	var clean []*Icon
 	for _, icon := range icons {
 		icon.URL = p.absURL(icon.URL)
 
@@ -90,7 +233,8 @@ func (p *parser) postProcessIcons(icons []*Icon) []*Icon {
 			icon.MimeType = mimeTypeURL(icon.URL)
 		}
 
-		if icon.URL == "" || icon.MimeType == "" {
+		// verification may determine a missing MIME type
+		if icon.URL == "" || (icon.MimeType == "" && !p.find.verify) {
 			continue
 		}
 
@@ -98,12 +242,66 @@ func (p *parser) postProcessIcons(icons []*Icon) []*Icon {
 			icon.FileExt = fileExt(icon.URL)
 		}
 
-		if icon.Width == 0 {
+		if sameMimeType(icon.MimeType, mimeSVG) {
+			icon.Scalable = true
+		}
+
+		if icon.Width == 0 && !icon.Scalable {
 			if sz := extractSizeFromURL(icon.URL); sz != nil {
 				icon.Width, icon.Height = sz.w, sz.h
 			}
 		}
+		clean = append(clean, icon)
+	}
+
+	if p.find.expandICO {
+		clean = p.find.expandICOIcons(ctx, clean)
+	}
+	if p.find.verify {
+		// expanded ICO icons already have their real sizes
+		var unverified []*Icon
+		for _, icon := range clean {
+			if icon.ICO == nil {
+				unverified = append(unverified, icon)
+			}
+		}
+		p.find.verifyIcons(ctx, unverified)
+	}
+
+	tidied := map[string]*Icon{}
+	for _, icon := range clean {
+		if icon.MimeType == "" {
+			continue
+		}
 		icon.Hash = iconHash(icon)
+		// later duplicates replace earlier ones, but keep their provenance
+		if v, ok := tidied[icon.Hash]; ok {
+			prov := icon.Provenance
+			icon.Provenance = v.Provenance
+			icon.Source, icon.Rel = v.Source, v.Rel
+			for _, pr := range prov {
+				icon.addProvenance(pr)
+			}
+			icon.Purpose = mergePurposes(v.Purpose, icon.Purpose)
+			if icon.Color == "" {
+				icon.Color = v.Color
+			}
+			if icon.Alt == "" {
+				icon.Alt = v.Alt
+			}
+			if icon.TwitterCard == "" {
+				icon.TwitterCard = v.TwitterCard
+			}
+			// an icon is only a mask if every source says so
+			icon.Mask = icon.Mask && v.Mask
+			if kindRank[v.Kind] < kindRank[icon.Kind] {
+				icon.Kind = v.Kind
+			}
+			// an icon declared for different media applies to all
+			if icon.Media != v.Media {
+				icon.Media = ""
+			}
+		}
 		tidied[icon.Hash] = icon
 	}
 
@@ -119,12 +317,57 @@ func (p *parser) postProcessIcons(icons []*Icon) []*Icon {
 		}
 	}
 
+	if p.find.colorScheme != "" {
+		icons = preferColorScheme(icons, p.find.colorScheme)
+	}
 	if p.find.sorter != nil {
 		sort.Sort(p.find.sorter(icons))
 	}
 	return icons
 }
 
+// remove icons for any colour scheme that have a variant for scheme of
+// the same kind and size
+func preferColorScheme(icons []*Icon, scheme string) []*Icon {
+	type variant struct {
+		kind          Kind
+		mask          bool
+		width, height int
+		scalable      bool
+	}
+	key := func(icon *Icon) variant {
+		return variant{icon.Kind, icon.Mask, icon.Width, icon.Height, icon.Scalable}
+	}
+	matched := map[variant]bool{}
+	for _, icon := range icons {
+		if icon.ColorScheme() == scheme {
+			matched[key(icon)] = true
+		}
+	}
+	kept := []*Icon{}
+	for _, icon := range icons {
+		if icon.ColorScheme() != "" || !matched[key(icon)] {
+			kept = append(kept, icon)
+		}
+	}
+	return kept
+}
+
+// return union of manifest icon purposes
+func mergePurposes(a, b []string) []string {
+	v := append([]string(nil), a...)
+outer:
+	for _, s := range b {
+		for _, s2 := range v {
+			if s == s2 {
+				continue outer
+			}
+		}
+		v = append(v, s)
+	}
+	return v
+}
+
 // returns a hash of icon's URL and size.
 func iconHash(i *Icon) string {
 	s := fmt.Sprintf("%s-%dx%d", i.URL, i.Width, i.Height)
@@ -7,6 +7,7 @@ package favicon
 import (
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -25,10 +26,11 @@ func TestFormat(t *testing.T) {
 	}{
 		// read from manifest & markup
 		{"kuli-0", "./testdata/kuli", 0, "png"}, // manifest
-		{"kuli-1", "./testdata/kuli", 1, "png"}, // markup
-		{"kuli-2", "./testdata/kuli", 2, "png"}, // manifest
+		{"kuli-1", "./testdata/kuli", 1, "png"}, // manifest
+		{"kuli-2", "./testdata/kuli", 2, "png"}, // markup
 		{"kuli-3", "./testdata/kuli", 3, "png"}, // markup
-		{"kuli-6", "./testdata/kuli", 6, "ico"}, // /favicon.ico
+		{"kuli-5", "./testdata/kuli", 5, "ico"}, // markup
+		{"kuli-7", "./testdata/kuli", 7, "png"}, // og:image, sorted last
 
 		// read from manifest
 		{"manifest-only-0", "./testdata/manifest-only", 0, "png"},
@@ -91,3 +93,229 @@ func TestIconCopy(t *testing.T) {
 		})
 	}
 }
+
+// TestProvenance verifies that icons record where they were found.
+func TestProvenance(t *testing.T) {
+	t.Parallel()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			_, _ = w.Write([]byte(`<html><head>
+<link rel="Shortcut Icon" href="/favicon.ico">
+<link rel="apple-touch-icon" href="/touch.png" sizes="180x180">
+<meta property="og:image" content="/touch-180x180.png">
+<meta name="twitter:image" content="/touch-180x180.png">
+</head></html>`))
+		case "/favicon.ico":
+			_, _ = w.Write([]byte{0, 0, 1, 0})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	f := New(WithClient(ts.Client()), WithLogger(debugLogger{}), IgnoreManifest)
+	icons, err := f.Find(ts.URL + "/")
+	require.Nil(t, err, "unexpected error")
+	require.Equal(t, 3, len(icons), "unexpected favicon count")
+
+	found := map[string]*Icon{}
+	for _, icon := range icons {
+		found[icon.URL] = icon
+	}
+
+	icon := found[ts.URL+"/touch.png"]
+	require.NotNil(t, icon, "touch icon not found")
+	assert.Equal(t, SourceLink, icon.Source, "unexpected source")
+	assert.Equal(t, "apple-touch-icon", icon.Rel, "unexpected rel")
+	assert.Equal(t, []Provenance{{
+		Source: SourceLink,
+		Rel:    "apple-touch-icon",
+		Origin: `<link rel="apple-touch-icon" href="/touch.png" sizes="180x180"/>`,
+	}}, icon.Provenance, "unexpected provenance")
+
+	// duplicates are merged
+	icon = found[ts.URL+"/favicon.ico"]
+	require.NotNil(t, icon, "favicon.ico not found")
+	assert.Equal(t, SourceLink, icon.Source, "unexpected source")
+	assert.Equal(t, "Shortcut Icon", icon.Rel, "unexpected rel")
+	assert.Equal(t, []Provenance{
+		{Source: SourceLink, Rel: "Shortcut Icon", Origin: `<link rel="Shortcut Icon" href="/favicon.ico"/>`},
+		{Source: SourceWellKnown, Origin: ts.URL + "/favicon.ico"},
+	}, icon.Provenance, "unexpected provenance")
+
+	icon = found[ts.URL+"/touch-180x180.png"]
+	require.NotNil(t, icon, "meta image not found")
+	assert.Equal(t, SourceOpenGraph, icon.Source, "unexpected source")
+	assert.Equal(t, []Provenance{
+		{Source: SourceOpenGraph, Rel: "og:image", Origin: `<meta property="og:image" content="/touch-180x180.png"/>`},
+		{Source: SourceTwitter, Rel: "twitter:image", Origin: `<meta name="twitter:image" content="/touch-180x180.png"/>`},
+	}, icon.Provenance, "unexpected provenance")
+}
+
+// TestScalable verifies handling of SVG and sizes="any" icons.
+func TestScalable(t *testing.T) {
+	t.Parallel()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			_, _ = w.Write([]byte(`<html><head>
+<link rel="icon" href="/icon.svg" type="image/svg+xml">
+<link rel="icon" href="/icon-32x32.png">
+<link rel="icon" href="/vector" sizes="any">
+<link rel="manifest" href="/manifest.json">
+</head></html>`))
+		case "/manifest.json":
+			_, _ = w.Write([]byte(`{"icons": [
+	{"src": "/app.svg", "sizes": "any", "type": "image/svg+xml"},
+	{"src": "/app-512.png", "sizes": "512x512"}
+]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	f := New(WithClient(ts.Client()), WithLogger(debugLogger{}), IgnoreWellKnown, OnlyMimeType("image/svg+xml", "image/png"))
+	icons, err := f.Find(ts.URL + "/")
+	require.Nil(t, err, "unexpected error")
+	require.Equal(t, 4, len(icons), "unexpected favicon count")
+	// scalable icons first
+	for i, x := range []string{"/app.svg", "/icon.svg", "/app-512.png", "/icon-32x32.png"} {
+		assert.Equal(t, ts.URL+x, icons[i].URL, "unexpected icon")
+		assert.Equal(t, i < 2, icons[i].Scalable, "unexpected scalable")
+	}
+
+	// scalable icons satisfy size filters
+	f = New(WithClient(ts.Client()), WithLogger(debugLogger{}), IgnoreWellKnown, IgnoreManifest, MinWidth(64), IgnoreNoSize)
+	icons, err = f.Find(ts.URL + "/")
+	require.Nil(t, err, "unexpected error")
+	require.Equal(t, 1, len(icons), "unexpected favicon count")
+	assert.Equal(t, ts.URL+"/icon.svg", icons[0].URL, "unexpected icon")
+}
+
+// TestMaskIcon verifies Safari pinned-tab icons.
+func TestMaskIcon(t *testing.T) {
+	t.Parallel()
+	html := `<html><head>
+<link rel="mask-icon" href="/pinned.svg" color="#5bbad5">
+<link rel="icon" href="/icon-32x32.png">
+</head></html>`
+
+	f := New(WithLogger(debugLogger{}))
+	icons, err := f.FindReader(strings.NewReader(html), "https://example.com")
+	require.Nil(t, err, "unexpected error")
+	require.Equal(t, 2, len(icons), "unexpected favicon count")
+	// masks are sorted last, even though they're scalable
+	assert.Equal(t, "https://example.com/icon-32x32.png", icons[0].URL, "unexpected icon")
+	mask := icons[1]
+	assert.Equal(t, "https://example.com/pinned.svg", mask.URL, "unexpected icon")
+	assert.True(t, mask.Mask, "not a mask")
+	assert.True(t, mask.Scalable, "mask not scalable")
+	assert.Equal(t, "#5bbad5", mask.Color, "unexpected color")
+	assert.Equal(t, "image/svg+xml", mask.MimeType, "unexpected MIME type")
+	assert.Equal(t, icons[0], Best(icons, 256), "mask chosen as best icon")
+
+	f = New(WithLogger(debugLogger{}), IgnoreMasks)
+	icons, err = f.FindReader(strings.NewReader(html), "https://example.com")
+	require.Nil(t, err, "unexpected error")
+	require.Equal(t, 1, len(icons), "unexpected favicon count")
+	assert.False(t, icons[0].Mask, "mask not ignored")
+
+	f = New(WithLogger(debugLogger{}), OnlyMasks)
+	icons, err = f.FindReader(strings.NewReader(html), "https://example.com")
+	require.Nil(t, err, "unexpected error")
+	require.Equal(t, 1, len(icons), "unexpected favicon count")
+	assert.True(t, icons[0].Mask, "non-mask returned")
+}
+
+// TestRelTokens verifies that rel attributes are parsed as keyword sets.
+func TestRelTokens(t *testing.T) {
+	t.Parallel()
+	html := `<html><head>
+<link rel="icon shortcut" href="/a.png">
+<link rel="apple-touch-icon icon" href="/b.png">
+<link rel="  ICON
+	" href="/c.png">
+<link rel="preload icon" href="/d.png">
+<link rel="stylesheet" href="/style.css">
+<link rel="iconic" href="/e.png">
+<link rel="mask-icon icon" href="/f.svg">
+</head></html>`
+
+	f := New(WithLogger(debugLogger{}), NopSort)
+	icons, err := f.FindReader(strings.NewReader(html), "https://example.com")
+	require.Nil(t, err, "unexpected error")
+	urls := []string{}
+	for _, icon := range icons {
+		urls = append(urls, icon.URL)
+	}
+	assert.ElementsMatch(t, []string{
+		"https://example.com/a.png",
+		"https://example.com/b.png",
+		"https://example.com/c.png",
+		"https://example.com/d.png",
+		"https://example.com/f.svg",
+	}, urls, "unexpected icons")
+}
+
+// TestColorScheme verifies media attributes and colour scheme filters.
+func TestColorScheme(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		media, x string
+	}{
+		{"", ""},
+		{"(prefers-color-scheme: dark)", ColorSchemeDark},
+		{"(prefers-color-scheme:light)", ColorSchemeLight},
+		{" ( Prefers-Color-Scheme : DARK ) ", ColorSchemeDark},
+		{"not (prefers-color-scheme: dark)", ColorSchemeLight},
+		{"(prefers-color-scheme: dark) and (min-width: 600px)", ""},
+		{"screen", ""},
+	}
+	for _, td := range tests {
+		assert.Equal(t, td.x, Icon{Media: td.media}.ColorScheme(), "media %q", td.media)
+	}
+
+	html := `<html><head>
+<link rel="icon" href="/light.svg" media="(prefers-color-scheme: light)">
+<link rel="icon" href="/dark.svg" media="(prefers-color-scheme: dark)">
+<link rel="icon" href="/any.png">
+</head></html>`
+	for _, td := range []struct {
+		scheme string
+		x      string
+	}{
+		{ColorSchemeLight, "https://example.com/light.svg"},
+		{ColorSchemeDark, "https://example.com/dark.svg"},
+	} {
+		f := New(WithLogger(debugLogger{}), ForColorScheme(td.scheme))
+		icons, err := f.FindReader(strings.NewReader(html), "https://example.com")
+		require.Nil(t, err, "unexpected error")
+		require.Equal(t, 2, len(icons), "unexpected favicon count")
+		assert.Equal(t, td.x, icons[0].URL, "unexpected icon")
+		assert.Equal(t, td.scheme, icons[0].ColorScheme(), "unexpected scheme")
+		assert.Equal(t, "https://example.com/any.png", icons[1].URL, "unexpected icon")
+	}
+
+	// generic icons give way to variants of the same size, even if they
+	// would sort first
+	html = `<html><head>
+<link rel="icon" href="/icon.svg">
+<link rel="icon" href="/icon-dark.svg" media="(prefers-color-scheme: dark)">
+<link rel="icon" href="/icon-16x16.png">
+</head></html>`
+	f := New(WithLogger(debugLogger{}), ForColorScheme(ColorSchemeDark))
+	icons, err := f.FindReader(strings.NewReader(html), "https://example.com")
+	require.Nil(t, err, "unexpected error")
+	require.Equal(t, 2, len(icons), "unexpected favicon count")
+	assert.Equal(t, "https://example.com/icon-dark.svg", icons[0].URL, "unexpected icon")
+	assert.Equal(t, "https://example.com/icon-16x16.png", icons[1].URL, "unexpected icon")
+	assert.Equal(t, "https://example.com/icon-dark.svg", Best(icons, 32).URL, "unexpected best icon")
+
+	icons, err = New(WithLogger(debugLogger{}), ForColorScheme(ColorSchemeLight)).
+		FindReader(strings.NewReader(html), "https://example.com")
+	require.Nil(t, err, "unexpected error")
+	require.Equal(t, 2, len(icons), "unexpected favicon count")
+	assert.Equal(t, "https://example.com/icon.svg", icons[0].URL, "unexpected icon")
+}
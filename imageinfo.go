@@ -0,0 +1,257 @@
+// MIT License
+//
+// Copyright (c) 2024 yulog
+
+package favicon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"image"
+	_ "image/gif"  // register GIF decoder
+	_ "image/jpeg" // register JPEG decoder
+	_ "image/png"  // register PNG decoder
+	"strconv"
+	"strings"
+)
+
+var (
+	// errUnknownFormat is returned for data that isn't a supported image format.
+	errUnknownFormat = errors.New("unknown image format")
+	// errTruncatedXML is returned for XML documents that end before their
+	// root element, i.e. that may be SVGs if more data is read.
+	errTruncatedXML = errors.New("truncated XML")
+)
+
+// format and dimensions of an image
+type imageInfo struct {
+	mimeType      string
+	width, height int
+	sizes         []size // all sizes in multi-image formats, e.g. ICO
+}
+
+// return true if image contains a version with the given dimensions
+func (info imageInfo) hasSize(w, h int) bool {
+	for _, sz := range info.sizes {
+		if sz.w == w && sz.h == h {
+			return true
+		}
+	}
+	return info.width == w && info.height == h
+}
+
+// MIME types of image formats recognised by readImageInfo
+const (
+	mimeBMP  = "image/bmp"
+	mimeGIF  = "image/gif"
+	mimeICO  = "image/x-icon"
+	mimeJPEG = "image/jpeg"
+	mimePNG  = "image/png"
+	mimeSVG  = "image/svg+xml"
+	mimeWebP = "image/webp"
+)
+
+// alternative MIME types for the same format
+var mimeAliases = map[string]string{
+	"image/vnd.microsoft.icon": mimeICO,
+	"image/ico":                mimeICO,
+	"image/icon":               mimeICO,
+	"image/jpg":                mimeJPEG,
+	"image/pjpeg":              mimeJPEG,
+	"image/x-ms-bmp":           mimeBMP,
+	"image/x-png":              mimePNG,
+	"image/svg":                mimeSVG,
+}
+
+// return true if MIME types a and b refer to the same format
+func sameMimeType(a, b string) bool {
+	if v, ok := mimeAliases[a]; ok {
+		a = v
+	}
+	if v, ok := mimeAliases[b]; ok {
+		b = v
+	}
+	return a == b
+}
+
+// determine format and dimensions of image from its contents
+func readImageInfo(data []byte) (imageInfo, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return decodeConfig(data, mimePNG)
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return decodeConfig(data, mimeGIF)
+	case bytes.HasPrefix(data, []byte("\xff\xd8\xff")):
+		return decodeConfig(data, mimeJPEG)
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return readWebPInfo(data)
+	case bytes.HasPrefix(data, []byte("BM")):
+		return readBMPInfo(data)
+	case bytes.HasPrefix(data, []byte("\x00\x00\x01\x00")):
+		return readICOInfo(data)
+	case isXML(data):
+		return readSVGInfo(data)
+	}
+	return imageInfo{}, errUnknownFormat
+}
+
+// use standard library decoders for PNG, GIF & JPEG
+func decodeConfig(data []byte, mimeType string) (imageInfo, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return imageInfo{}, err
+	}
+	return imageInfo{mimeType: mimeType, width: cfg.Width, height: cfg.Height}, nil
+}
+
+// read dimensions from the VP8, VP8L or VP8X chunk of a WebP file.
+// https://developers.google.com/speed/webp/docs/riff_container
+func readWebPInfo(data []byte) (imageInfo, error) {
+	info := imageInfo{mimeType: mimeWebP}
+	if len(data) < 30 {
+		return info, errors.New("webp: file too short")
+	}
+
+	switch string(data[12:16]) {
+	case "VP8 ": // lossy; frame header follows 3-byte frame tag
+		if !bytes.Equal(data[23:26], []byte{0x9d, 0x01, 0x2a}) {
+			return info, errors.New("webp: invalid VP8 frame")
+		}
+		info.width = int(binary.LittleEndian.Uint16(data[26:28]) & 0x3fff)
+		info.height = int(binary.LittleEndian.Uint16(data[28:30]) & 0x3fff)
+	case "VP8L": // lossless; 14-bit width-1 & height-1 after signature
+		if data[20] != 0x2f {
+			return info, errors.New("webp: invalid VP8L signature")
+		}
+		bits := binary.LittleEndian.Uint32(data[21:25])
+		info.width = int(bits&0x3fff) + 1
+		info.height = int((bits>>14)&0x3fff) + 1
+	case "VP8X": // extended; 24-bit canvas width-1 & height-1
+		info.width = int(uint32(data[24])|uint32(data[25])<<8|uint32(data[26])<<16) + 1
+		info.height = int(uint32(data[27])|uint32(data[28])<<8|uint32(data[29])<<16) + 1
+	default:
+		return info, errors.New("webp: unknown chunk type")
+	}
+	return info, nil
+}
+
+// read dimensions from the DIB header of a BMP file.
+func readBMPInfo(data []byte) (imageInfo, error) {
+	info := imageInfo{mimeType: mimeBMP}
+	if len(data) < 26 {
+		return info, errors.New("bmp: file too short")
+	}
+
+	if binary.LittleEndian.Uint32(data[14:18]) == 12 { // OS/2 BITMAPCOREHEADER
+		info.width = int(binary.LittleEndian.Uint16(data[18:20]))
+		info.height = int(binary.LittleEndian.Uint16(data[20:22]))
+		return info, nil
+	}
+
+	info.width = int(int32(binary.LittleEndian.Uint32(data[18:22])))
+	info.height = int(int32(binary.LittleEndian.Uint32(data[22:26])))
+	if info.height < 0 { // top-down bitmap
+		info.height = -info.height
+	}
+	return info, nil
+}
+
+// read dimensions of largest image in an ICO file.
+func readICOInfo(data []byte) (imageInfo, error) {
+	info := imageInfo{mimeType: mimeICO}
+	images, err := ParseICO(data)
+	if err != nil {
+		return info, err
+	}
+	for _, img := range images {
+		info.sizes = append(info.sizes, size{w: img.Width, h: img.Height})
+		if img.Width > info.width {
+			info.width, info.height = img.Width, img.Height
+		}
+	}
+	return info, nil
+}
+
+// return true if data looks like the start of an XML document
+func isXML(data []byte) bool {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")) // UTF-8 BOM
+	data = bytes.TrimSpace(data)
+	return bytes.HasPrefix(data, []byte("<?xml")) ||
+		bytes.HasPrefix(data, []byte("<svg")) ||
+		bytes.HasPrefix(data, []byte("<!--")) ||
+		bytes.HasPrefix(data, []byte("<!DOCTYPE svg"))
+}
+
+// return true if data is the start of an XML document that ends before its
+// root element, e.g. in a long prolog
+func isTruncatedXML(data []byte) bool {
+	if !isXML(data) {
+		return false
+	}
+	_, err := readSVGInfo(data)
+	return errors.Is(err, errTruncatedXML)
+}
+
+// read intrinsic dimensions of an SVG from the width and height attributes
+// of its root element, falling back to its viewBox. Returns errTruncatedXML
+// if data ends before the root element.
+func readSVGInfo(data []byte) (imageInfo, error) {
+	info := imageInfo{mimeType: mimeSVG}
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = false
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			// errors at the end of data, e.g. in an unterminated
+			// comment, may go away with more data
+			if dec.InputOffset() >= int64(len(data)) {
+				return imageInfo{}, errTruncatedXML
+			}
+			return imageInfo{}, errUnknownFormat
+		}
+		el, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if el.Name.Local != "svg" {
+			return imageInfo{}, errUnknownFormat
+		}
+
+		var viewBox string
+		for _, attr := range el.Attr {
+			switch attr.Name.Local {
+			case "width":
+				info.width = parseSVGLength(attr.Value)
+			case "height":
+				info.height = parseSVGLength(attr.Value)
+			case "viewBox":
+				viewBox = attr.Value
+			}
+		}
+		if info.width == 0 || info.height == 0 {
+			// viewBox is "min-x min-y width height", separated by
+			// whitespace and/or commas
+			v := strings.FieldsFunc(viewBox, func(r rune) bool {
+				return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+			})
+			if len(v) == 4 {
+				info.width = parseSVGLength(v[2])
+				info.height = parseSVGLength(v[3])
+			}
+		}
+		return info, nil
+	}
+}
+
+// parse an absolute SVG length in pixels. Returns 0 for relative units,
+// e.g. "100%" or "2em".
+func parseSVGLength(s string) int {
+	s = strings.TrimSuffix(strings.TrimSpace(s), "px")
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return int(n + 0.5)
+}
@@ -0,0 +1,106 @@
+// MIT License
+//
+// Copyright (c) 2024 yulog
+
+package favicon
+
+import (
+	"path"
+	"strings"
+)
+
+// Kind classifies an Icon by what it's meant for.
+type Kind string
+
+// Kinds of Icon.
+const (
+	// Browser tab icons: <link rel="icon">, /favicon.ico, mask icons.
+	KindFavicon Kind = "favicon"
+	// Home screen icons for iOS: <link rel="apple-touch-icon">,
+	// /apple-touch-icon.png.
+	KindTouchIcon Kind = "touch-icon"
+	// Icons of installed or pinned web apps: manifest icons, Windows
+	// tiles and Fluid app icons.
+	KindAppIcon Kind = "app-icon"
+	// Official logos from schema.org structured data, e.g.
+	// Organization.logo, and logos and photos of h-cards. Often larger
+	// than favicons and not square.
+	KindLogo Kind = "logo"
+	// Preview images for social media: Open Graph and Twitter images.
+	// Usually large banners or photos rather than logos.
+	KindSocialImage Kind = "social-image"
+)
+
+// Kinds in order of preference when an image has several, e.g. a page
+// that uses its logo as both icon and og:image.
+var kindRank = map[Kind]int{
+	KindFavicon:     1,
+	KindTouchIcon:   2,
+	KindAppIcon:     3,
+	KindLogo:        4,
+	KindSocialImage: 5,
+}
+
+// OnlyKind ignores Icons that aren't one of the given kinds.
+func OnlyKind(kind ...Kind) Option {
+	return WithFilter(func(icon *Icon) *Icon {
+		for _, k := range kind {
+			if icon.Kind == k {
+				return icon
+			}
+		}
+		return nil
+	})
+}
+
+var (
+	// OnlyFavicons ignores touch icons, app icons, logos and social images.
+	OnlyFavicons Option = OnlyKind(KindFavicon)
+
+	// ExcludeSocialImages ignores Open Graph and Twitter images.
+	ExcludeSocialImages Option = WithFilter(func(icon *Icon) *Icon {
+		if icon.Kind == KindSocialImage {
+			return nil
+		}
+		return icon
+	})
+
+	// SeparateSocialImages moves social images from Result.Icons to
+	// Result.SocialImages. They are filtered and sorted like other icons.
+	// Find() and other functions that return only icons don't return
+	// social images.
+	SeparateSocialImages Option = func(f *Finder) { f.separateSocialImages = true }
+)
+
+// return the kind of an icon in a <link> tag with the given rel keywords
+func linkKind(tokens map[string]bool) Kind {
+	switch {
+	case tokens["apple-touch-icon"], tokens["apple-touch-icon-precomposed"]:
+		return KindTouchIcon
+	case tokens["fluid-icon"]:
+		return KindAppIcon
+	default:
+		return KindFavicon
+	}
+}
+
+// return the kind of an icon at a well-known URL
+func wellKnownKind(u string) Kind {
+	if strings.HasPrefix(path.Base(u), "apple-touch-icon") {
+		return KindTouchIcon
+	}
+	return KindFavicon
+}
+
+// split icons into social images and all others
+func splitSocialImages(icons []*Icon) (other, social []*Icon) {
+	other = []*Icon{}
+	for _, icon := range icons {
+		if icon.Kind == KindSocialImage {
+			social = append(social, icon)
+		} else {
+			other = append(other, icon)
+		}
+	}
+	return other, social
+}
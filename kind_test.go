@@ -0,0 +1,85 @@
+// MIT License
+//
+// Copyright (c) 2024 yulog
+
+package favicon
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestKind verifies classification of icons and Kind options.
+func TestKind(t *testing.T) {
+	t.Parallel()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			_, _ = w.Write([]byte(`<html><head>
+<link rel="icon" href="/icon-32x32.png">
+<link rel="apple-touch-icon" href="/touch-180x180.png">
+<link rel="manifest" href="/manifest.json">
+<meta property="og:image" content="/hero.jpg">
+<meta property="og:image:width" content="1200">
+<meta property="og:image:height" content="630">
+<meta property="og:image" content="/logo-256x256.png">
+<meta name="twitter:image" content="/icon-32x32.png">
+</head></html>`))
+		case "/manifest.json":
+			_, _ = w.Write([]byte(`{"icons": [{"src": "/app-512x512.png", "sizes": "512x512"}]}`))
+		case "/favicon.ico":
+			_, _ = w.Write(encodeImage(t, "png", 16, 16))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	opts := []Option{WithClient(ts.Client()), WithLogger(debugLogger{})}
+	kinds := func(icons []*Icon) map[string]Kind {
+		m := map[string]Kind{}
+		for _, icon := range icons {
+			m[strings.TrimPrefix(icon.URL, ts.URL)] = icon.Kind
+		}
+		return m
+	}
+
+	icons, err := New(opts...).Find(ts.URL + "/")
+	require.Nil(t, err, "unexpected error")
+	assert.Equal(t, map[string]Kind{
+		"/icon-32x32.png":    KindFavicon, // also twitter:image
+		"/touch-180x180.png": KindTouchIcon,
+		"/app-512x512.png":   KindAppIcon,
+		"/hero.jpg":          KindSocialImage,
+		"/logo-256x256.png":  KindSocialImage,
+		"/favicon.ico":       KindFavicon,
+	}, kinds(icons), "unexpected kinds")
+	// social images are sorted last, despite their size
+	assert.Equal(t, ts.URL+"/app-512x512.png", icons[0].URL, "unexpected first icon")
+	assert.Equal(t, KindSocialImage, icons[len(icons)-1].Kind, "unexpected last icon")
+	assert.Equal(t, ts.URL+"/app-512x512.png", Best(icons, 1024).URL, "unexpected best icon")
+
+	icons, err = New(append(opts, OnlyFavicons)...).Find(ts.URL + "/")
+	require.Nil(t, err, "unexpected error")
+	assert.Equal(t, map[string]Kind{
+		"/icon-32x32.png": KindFavicon,
+		"/favicon.ico":    KindFavicon,
+	}, kinds(icons), "unexpected OnlyFavicons icons")
+
+	icons, err = New(append(opts, ExcludeSocialImages)...).Find(ts.URL + "/")
+	require.Nil(t, err, "unexpected error")
+	assert.Equal(t, 4, len(icons), "unexpected favicon count")
+	assert.NotContains(t, kinds(icons), "/hero.jpg", "social image not excluded")
+
+	res, err := New(append(opts, SeparateSocialImages)...).FindDetailed(ts.URL + "/")
+	require.Nil(t, err, "unexpected error")
+	assert.Equal(t, 4, len(res.Icons), "unexpected favicon count")
+	require.Equal(t, 2, len(res.SocialImages), "unexpected social image count")
+	assert.Equal(t, ts.URL+"/hero.jpg", res.SocialImages[0].URL, "unexpected social image")
+	assert.Equal(t, 1200, res.SocialImages[0].Width, "unexpected width")
+}
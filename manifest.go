@@ -5,17 +5,35 @@
 package favicon
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	urls "net/url"
 	"path/filepath"
 	"regexp"
 	"strconv"
+	"strings"
 )
 
-// Manifest is the relevant parts of a manifest.json file.
+// Manifest is a W3C Web App Manifest (manifest.json file).
+// See https://www.w3.org/TR/appmanifest/
+//
+// Manifests returned by ParseManifest have all URLs resolved against the
+// manifest's own URL.
 type Manifest struct {
-	Icons []ManifestIcon `json:"icons"`
+	// URL the manifest was loaded from. Not part of the manifest itself.
+	URL string `json:"-"`
+
+	ID              string             `json:"id,omitempty"`
+	Name            string             `json:"name,omitempty"`
+	ShortName       string             `json:"short_name,omitempty"`
+	StartURL        string             `json:"start_url,omitempty"`
+	Scope           string             `json:"scope,omitempty"`
+	ThemeColor      string             `json:"theme_color,omitempty"`
+	BackgroundColor string             `json:"background_color,omitempty"`
+	Icons           []ManifestIcon     `json:"icons"`
+	Shortcuts       []ManifestShortcut `json:"shortcuts,omitempty"`
 }
 
 // ManifestIcon is an icon from a manifest.json file.
@@ -23,50 +41,147 @@ type ManifestIcon struct {
 	URL      string `json:"src"`
 	Type     string `json:"type"`
 	RawSizes string `json:"sizes"`
+	// Space-separated list of purposes: "any", "maskable" and/or
+	// "monochrome". Empty means "any".
+	RawPurpose string `json:"purpose,omitempty"`
+}
+
+// Purposes returns the icon's purposes. It returns ["any"] if the
+// manifest doesn't specify a purpose.
+func (mi ManifestIcon) Purposes() []string {
+	v := strings.Fields(strings.ToLower(mi.RawPurpose))
+	if len(v) == 0 {
+		return []string{PurposeAny}
+	}
+	return v
+}
+
+// Purposes of manifest icons.
+const (
+	PurposeAny        = "any"
+	PurposeMaskable   = "maskable"
+	PurposeMonochrome = "monochrome"
+)
+
+// ManifestShortcut is an app shortcut from a manifest.json file. Its icons
+// represent the shortcut, not the site, so Finder doesn't return them.
+type ManifestShortcut struct {
+	Name        string         `json:"name"`
+	ShortName   string         `json:"short_name,omitempty"`
+	Description string         `json:"description,omitempty"`
+	URL         string         `json:"url"`
+	Icons       []ManifestIcon `json:"icons,omitempty"`
 }
 
 type size struct {
 	w, h int
+	any  bool // sizes="any", i.e. a scalable icon
+}
+
+// ParseManifest parses a manifest.json file read from r. Relative URLs in
+// the manifest are resolved against manifestURL, which may be empty.
+func ParseManifest(r io.Reader, manifestURL string) (*Manifest, error) {
+	man := &Manifest{URL: manifestURL}
+	if err := json.NewDecoder(r).Decode(man); err != nil {
+		return nil, fmt.Errorf("decode manifest: %w", err)
+	}
+
+	var base *urls.URL
+	if manifestURL != "" {
+		u, err := urls.Parse(manifestURL)
+		if err != nil {
+			return nil, fmt.Errorf("manifest URL: %w", err)
+		}
+		base = u
+	}
+
+	resolve := func(base *urls.URL, s string) string {
+		if s == "" || base == nil {
+			return s
+		}
+		u, err := urls.Parse(s)
+		if err != nil {
+			return ""
+		}
+		return base.ResolveReference(u).String()
+	}
+	resolveIcons := func(icons []ManifestIcon) {
+		for i := range icons {
+			icons[i].URL = resolve(base, icons[i].URL)
+		}
+	}
+
+	man.StartURL = resolve(base, man.StartURL)
+	man.Scope = resolve(base, man.Scope)
+	man.ID = resolveManifestID(man.ID, man.StartURL)
+	resolveIcons(man.Icons)
+	for i := range man.Shortcuts {
+		man.Shortcuts[i].URL = resolve(base, man.Shortcuts[i].URL)
+		resolveIcons(man.Shortcuts[i].Icons)
+	}
+	return man, nil
+}
+
+// resolve a manifest's id against the origin of its (resolved) start_url.
+// The id defaults to start_url, and is replaced by it if it has a
+// different origin. See https://www.w3.org/TR/appmanifest/#id-member
+func resolveManifestID(id, startURL string) string {
+	start, err := urls.Parse(startURL)
+	if err != nil || id == "" {
+		return startURL
+	}
+	u, err := urls.Parse(id)
+	if err != nil {
+		return startURL
+	}
+	origin := &urls.URL{Scheme: start.Scheme, Host: start.Host, Path: "/"}
+	u = origin.ResolveReference(u)
+	if u.Scheme != start.Scheme || u.Host != start.Host {
+		return startURL
+	}
+	u.Fragment, u.RawFragment = "", ""
+	return u.String()
 }
 
-func (p *parser) parseManifest(url string) []*Icon {
+func (p *parser) parseManifest(ctx context.Context, url string) ([]*Icon, error) {
 	p.find.log.Printf("loading manifest %q ...", url)
-	rc, err := p.find.fetchURL(url)
+	rc, err := p.find.fetchURL(ctx, url)
 	if err != nil {
 		p.find.log.Printf("[ERROR] parse manifest: %v", err)
-		return nil
+		return nil, err
 	}
 	defer rc.Close()
 
-	return p.parseManifestReader(rc)
+	return p.parseManifestReader(rc, url)
 }
 
-func (p *parser) parseManifestReader(r io.Reader) []*Icon {
-	var (
-		icons []*Icon
-		man   = Manifest{}
-		err   error
-	)
-
-	dec := json.NewDecoder(r)
-	if err = dec.Decode(&man); err != nil {
+// parse manifest read from r. url is the manifest's URL.
+func (p *parser) parseManifestReader(r io.Reader, url string) ([]*Icon, error) {
+	man, err := ParseManifest(r, url)
+	if err != nil {
 		p.find.log.Printf("[ERROR] parse manifest: %v", err)
+		return nil, err
 	}
+
+	var icons []*Icon
 	for _, mi := range man.Icons {
-		// TODO: make URL relative to manifest, not page
-		mi.URL = p.absURL(mi.URL)
 		p.find.log.Printf("(manifest) %s", mi.URL)
 		for _, sz := range parseSizes(mi.RawSizes) {
 			icon := &Icon{
-				URL:    mi.URL,
-				Width:  sz.w,
-				Height: sz.h,
+				URL:      mi.URL,
+				MimeType: mi.Type,
+				Width:    sz.w,
+				Height:   sz.h,
+				Scalable: sz.any,
+				Purpose:  mi.Purposes(),
+				Kind:     KindAppIcon,
 			}
+			icon.addProvenance(Provenance{Source: SourceManifest, Origin: url})
 			icons = append(icons, icon)
 		}
 	}
 
-	return icons
+	return icons, nil
 }
 
 var (
@@ -74,12 +189,15 @@ var (
 	rxWidth = regexp.MustCompile(`-(\d+)$`)
 )
 
+// parse the value of a sizes attribute, e.g. "16x16 32x32" or "any"
 func parseSizes(s string) []size {
-	m := rxSize.FindAllStringSubmatch(s, -1)
-	if m == nil {
-		return nil
-	}
 	var sizes []size
+	for _, tok := range strings.Fields(s) {
+		if strings.EqualFold(tok, "any") {
+			sizes = append(sizes, size{any: true})
+		}
+	}
+	m := rxSize.FindAllStringSubmatch(s, -1)
 	for _, l := range m {
 		for i := 1; i < len(l)-1; i += 2 {
 			w, _ := strconv.ParseInt(l[i], 10, 32)
@@ -93,9 +211,10 @@ func parseSizes(s string) []size {
 // find dimensions in URL
 func extractSizeFromURL(url string) *size {
 	// try to find WxH pattern
-	v := parseSizes(url)
-	if len(v) > 0 {
-		return &v[0]
+	for _, sz := range parseSizes(url) {
+		if !sz.any {
+			return &sz
+		}
 	}
 
 	// look for -NNN at end of filename
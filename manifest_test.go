@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	urls "net/url"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -53,9 +54,10 @@ func TestParseSize(t *testing.T) {
 	}{
 		// size read from manifest & markup
 		{"kuli-0", "./testdata/kuli", 0, 512, 512, true}, // manifest
-		{"kuli-1", "./testdata/kuli", 1, 400, 400, true}, // markup
-		{"kuli-2", "./testdata/kuli", 2, 192, 192, true}, // manifest
-		{"kuli-3", "./testdata/kuli", 3, 180, 180, true}, // markup
+		{"kuli-1", "./testdata/kuli", 1, 192, 192, true}, // manifest
+		{"kuli-2", "./testdata/kuli", 2, 180, 180, true}, // markup
+		{"kuli-3", "./testdata/kuli", 3, 32, 32, true},   // markup
+		{"kuli-7", "./testdata/kuli", 7, 400, 400, true}, // og:image, sorted last
 
 		// size read from manifest
 		{"manifest-only-0", "./testdata/manifest-only", 0, 512, 512, true},
@@ -97,3 +99,71 @@ func mustURL(s string) *urls.URL {
 	}
 	return u
 }
+
+// TestParseManifest tests the manifest model and URL resolution.
+func TestParseManifest(t *testing.T) {
+	t.Parallel()
+	data := `{
+	"id": "?app=1",
+	"name": "Example App",
+	"short_name": "Example",
+	"start_url": "../start/",
+	"scope": "../",
+	"theme_color": "#ffffff",
+	"background_color": "#000000",
+	"icons": [
+		{"src": "icon-192.png", "sizes": "192x192", "type": "image/png"},
+		{"src": "/mask.png", "sizes": "512x512", "purpose": "maskable monochrome"}
+	],
+	"shortcuts": [
+		{"name": "New", "url": "new", "icons": [{"src": "new.png", "sizes": "96x96"}]}
+	]
+}`
+	man, err := ParseManifest(strings.NewReader(data), "https://example.com/app/static/manifest.json")
+	require.Nil(t, err, "unexpected error")
+	assert.Equal(t, "Example App", man.Name, "unexpected name")
+	assert.Equal(t, "Example", man.ShortName, "unexpected short name")
+	assert.Equal(t, "#ffffff", man.ThemeColor, "unexpected theme colour")
+	assert.Equal(t, "#000000", man.BackgroundColor, "unexpected background colour")
+	assert.Equal(t, "https://example.com/app/start/", man.StartURL, "unexpected start URL")
+	assert.Equal(t, "https://example.com/app/", man.Scope, "unexpected scope")
+	assert.Equal(t, "https://example.com/?app=1", man.ID, "unexpected ID")
+
+	require.Equal(t, 2, len(man.Icons), "unexpected icon count")
+	assert.Equal(t, "https://example.com/app/static/icon-192.png", man.Icons[0].URL, "unexpected icon URL")
+	assert.Equal(t, []string{"any"}, man.Icons[0].Purposes(), "unexpected purpose")
+	assert.Equal(t, "https://example.com/mask.png", man.Icons[1].URL, "unexpected icon URL")
+	assert.Equal(t, []string{"maskable", "monochrome"}, man.Icons[1].Purposes(), "unexpected purpose")
+
+	require.Equal(t, 1, len(man.Shortcuts), "unexpected shortcut count")
+	assert.Equal(t, "https://example.com/app/static/new", man.Shortcuts[0].URL, "unexpected shortcut URL")
+	assert.Equal(t, "https://example.com/app/static/new.png", man.Shortcuts[0].Icons[0].URL, "unexpected shortcut icon URL")
+
+	// id defaults to start_url, which also replaces cross-origin ids
+	for _, id := range []string{``, `"id": "https://other.example/app",`} {
+		man, err := ParseManifest(strings.NewReader(`{`+id+`"start_url": "/start#top"}`), "https://example.com/manifest.json")
+		require.Nil(t, err, "unexpected error")
+		assert.Equal(t, "https://example.com/start#top", man.ID, "unexpected default ID")
+	}
+
+	// Finder resolves manifest icons against the manifest, not the page
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page/":
+			_, _ = w.Write([]byte(`<html><head><link rel="manifest" href="/static/app.json"></head></html>`))
+		case "/static/app.json":
+			_, _ = w.Write([]byte(data))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	f := New(WithClient(ts.Client()), WithLogger(debugLogger{}), IgnoreWellKnown)
+	icons, err := f.Find(ts.URL + "/page/")
+	require.Nil(t, err, "unexpected error")
+	require.Equal(t, 2, len(icons), "unexpected favicon count")
+	assert.Equal(t, ts.URL+"/mask.png", icons[0].URL, "unexpected icon URL")
+	assert.Equal(t, []string{"maskable", "monochrome"}, icons[0].Purpose, "unexpected purpose")
+	assert.Equal(t, ts.URL+"/static/icon-192.png", icons[1].URL, "unexpected icon URL")
+}
@@ -0,0 +1,239 @@
+// MIT License
+//
+// Copyright (c) 2024 yulog
+
+package favicon
+
+import (
+	"strings"
+
+	gq "github.com/PuerkitoBio/goquery"
+)
+
+// IgnoreMicroformats ignores logos and photos in h-card microformats.
+var IgnoreMicroformats Option = func(f *Finder) { f.ignoreMicroformats = true }
+
+// extract the u-logo and u-photo properties of the page's representative
+// h-card, i.e. the microformats2 h-card of the person or organisation the
+// page belongs to.
+func (p *parser) parseMicroformats(doc *gq.Document) []*Icon {
+	card := p.representativeHCard(doc)
+	if card == nil {
+		return nil
+	}
+
+	var icons []*Icon
+	add := func(sel *gq.Selection, rel string) {
+		icon := &Icon{URL: mfURL(sel), Kind: KindLogo}
+		if icon.URL == "" {
+			return
+		}
+		if gq.NodeName(sel) == "img" {
+			w, _ := sel.Attr("width")
+			h, _ := sel.Attr("height")
+			icon.Width, icon.Height = parseDimension(w), parseDimension(h)
+			icon.Alt, _ = sel.Attr("alt")
+		}
+		icon.addProvenance(Provenance{Source: SourceMicroformats, Rel: rel, Origin: outerHTML(sel)})
+		p.find.log.Printf("(microformats) %s", icon.URL)
+		icons = append(icons, icon)
+	}
+
+	mfProperty(card, "u-logo").Each(func(i int, sel *gq.Selection) { add(sel, "u-logo") })
+	photos := mfProperty(card, "u-photo")
+	if photos.Length() == 0 && mfImplies(card) {
+		photos = mfImplied(card, "src", "img")
+	}
+	photos.Each(func(i int, sel *gq.Selection) { add(sel, "u-photo") })
+	return icons
+}
+
+// return the representative h-card of the page, or nil if there is none.
+// See https://microformats.org/wiki/representative-h-card-parsing
+func (p *parser) representativeHCard(doc *gq.Document) *gq.Selection {
+	var page string
+	if p.baseURL != nil {
+		page = p.baseURL.String()
+	}
+
+	// top-level h-cards with their URLs
+	type hCard struct {
+		sel        *gq.Selection
+		urls, uids []string
+	}
+	var cards []hCard
+	doc.Find(".h-card").Each(func(i int, sel *gq.Selection) {
+		if sel.Parents().FilterFunction(isMFRoot).Length() > 0 {
+			return
+		}
+		urls := mfProperty(sel, "u-url")
+		if urls.Length() == 0 && mfImplies(sel) {
+			urls = mfImplied(sel, "href", "a", "area")
+		}
+		cards = append(cards, hCard{sel, p.mfURLs(urls), p.mfURLs(mfProperty(sel, "u-uid"))})
+	})
+
+	// an h-card whose uid and url are both the page's URL
+	for _, c := range cards {
+		if containsURL(c.uids, page) && containsURL(c.urls, page) {
+			return c.sel
+		}
+	}
+
+	// an h-card with a url that is also a rel="me" link
+	var me []string
+	doc.Find("a[rel], link[rel]").Each(func(i int, sel *gq.Selection) {
+		rel, _ := sel.Attr("rel")
+		if href, ok := sel.Attr("href"); ok && relTokens(rel)["me"] {
+			me = append(me, p.absURL(strings.TrimSpace(href)))
+		}
+	})
+	for _, c := range cards {
+		for _, u := range c.urls {
+			if containsURL(me, u) {
+				return c.sel
+			}
+		}
+	}
+
+	// the only h-card, if its url is the page's URL
+	if len(cards) == 1 && containsURL(cards[0].urls, page) {
+		return cards[0].sel
+	}
+	return nil
+}
+
+// return absolute URLs of u-* properties
+func (p *parser) mfURLs(sel *gq.Selection) []string {
+	var urls []string
+	sel.Each(func(i int, sel *gq.Selection) {
+		if u := mfURL(sel); u != "" {
+			urls = append(urls, p.absURL(u))
+		}
+	})
+	return urls
+}
+
+// whether urls contains u. A trailing slash is ignored, as "example.com"
+// and "example.com/" are the same site.
+func containsURL(urls []string, u string) bool {
+	if u == "" {
+		return false
+	}
+	for _, s := range urls {
+		if strings.TrimSuffix(s, "/") == strings.TrimSuffix(u, "/") {
+			return true
+		}
+	}
+	return false
+}
+
+// whether the class attribute of sel has a microformats2 root class,
+// e.g. "h-card"
+func isMFRoot(i int, sel *gq.Selection) bool {
+	class, _ := sel.Attr("class")
+	for _, tok := range strings.Fields(class) {
+		if isMFName(tok, "h-") {
+			return true
+		}
+	}
+	return false
+}
+
+// whether s is a microformats2 class name with prefix, e.g. "u-photo"
+func isMFName(s, prefix string) bool {
+	name, ok := strings.CutPrefix(s, prefix)
+	if !ok || name == "" || name[0] == '-' || name[len(name)-1] == '-' {
+		return false
+	}
+	for _, r := range name {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// return the elements of the given property class, e.g. "u-photo", that
+// belong to microformat root rather than to a nested microformat
+func mfProperty(root *gq.Selection, class string) *gq.Selection {
+	return root.Find("." + class).FilterFunction(func(i int, sel *gq.Selection) bool {
+		return sel.Parents().FilterFunction(isMFRoot).First().IsSelection(root)
+	})
+}
+
+// whether properties may be implied for root, i.e. it has no explicit
+// u-* or e-* properties and no nested microformats
+func mfImplies(root *gq.Selection) bool {
+	explicit := root.Find("[class]").FilterFunction(func(i int, sel *gq.Selection) bool {
+		if isMFRoot(i, sel) {
+			return true
+		}
+		if !sel.Parents().FilterFunction(isMFRoot).First().IsSelection(root) {
+			return false
+		}
+		class, _ := sel.Attr("class")
+		for _, tok := range strings.Fields(class) {
+			if isMFName(tok, "u-") || isMFName(tok, "e-") {
+				return true
+			}
+		}
+		return false
+	})
+	return explicit.Length() == 0
+}
+
+// return the element an implied property is taken from: root, its only
+// child or its only child's only child of one of the given types with
+// attribute attr. Returns an empty selection if there is none.
+func mfImplied(root *gq.Selection, attr string, tags ...string) *gq.Selection {
+	candidate := func(sel *gq.Selection, tag string) bool {
+		_, ok := sel.Attr(attr)
+		return ok && sel.Length() == 1 && gq.NodeName(sel) == tag && !isMFRoot(0, sel)
+	}
+	for _, tag := range tags {
+		if _, ok := root.Attr(attr); ok && gq.NodeName(root) == tag {
+			return root
+		}
+	}
+	for _, tag := range tags {
+		if sel := root.ChildrenFiltered(tag); candidate(sel, tag) {
+			return sel
+		}
+	}
+	if child := root.Children(); child.Length() == 1 && !isMFRoot(0, child) {
+		for _, tag := range tags {
+			if sel := child.ChildrenFiltered(tag); candidate(sel, tag) {
+				return sel
+			}
+		}
+	}
+	return root.Slice(0, 0)
+}
+
+// return the value of a u-* property
+// (https://microformats.org/wiki/microformats2-parsing#parsing_a_u-_property)
+func mfURL(sel *gq.Selection) string {
+	var attr string
+	switch gq.NodeName(sel) {
+	case "a", "area", "link":
+		attr = "href"
+	case "img", "audio", "source", "iframe":
+		attr = "src"
+	case "video":
+		attr = "src"
+		if _, ok := sel.Attr("src"); !ok {
+			attr = "poster"
+		}
+	case "object":
+		attr = "data"
+	case "abbr":
+		attr = "title"
+	case "data", "input":
+		attr = "value"
+	default:
+		return strings.TrimSpace(sel.Text())
+	}
+	s, _ := sel.Attr(attr)
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,91 @@
+// MIT License
+//
+// Copyright (c) 2024 yulog
+
+package favicon
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/html"
+)
+
+// TestMicroformats verifies logos and photos of representative h-cards.
+func TestMicroformats(t *testing.T) {
+	t.Parallel()
+	type image struct {
+		url, rel, alt string
+	}
+	tests := []struct {
+		name string
+		base string // page URL
+		html string
+		x    []image
+	}{
+		{"uid and url", "https://example.com/", `
+<div class="h-card">
+  <a class="u-url u-uid p-name" href="/">Jane</a>
+  <img class="u-photo" src="/jane.jpg" alt="Jane">
+  <img class="u-logo" src="/logo.png">
+  <div class="p-org h-card"><img class="u-logo" src="/acme.png"> Acme</div>
+</div>
+<div class="h-card"><a class="u-url" href="https://example.com/">Other</a><img class="u-photo" src="/other.jpg"></div>`,
+			[]image{{"https://example.com/jane.jpg", "u-photo", "Jane"}, {"https://example.com/logo.png", "u-logo", ""}}},
+		{"rel me", "https://example.com/about", `
+<link rel="me" href="https://social.example/@jane">
+<div class="h-card"><a class="u-url" href="https://other.example/">Other</a><img class="u-photo" src="/other.jpg"></div>
+<div class="h-card"><a class="u-url" href="https://social.example/@jane">Jane</a><img class="u-photo" src="/jane.jpg"></div>`,
+			[]image{{"https://example.com/jane.jpg", "u-photo", ""}}},
+		{"implied", "https://example.com", `<a class="h-card" href="/"><img src="/jane.jpg" alt="Jane"></a>`,
+			[]image{{"https://example.com/jane.jpg", "u-photo", "Jane"}}},
+		{"single card elsewhere", "https://example.com/", `<a class="h-card" href="https://other.example/"><img src="/x.jpg"></a>`, nil},
+		{"several cards", "https://example.com/", `
+<a class="h-card" href="/"><img src="/a.jpg"></a>
+<a class="h-card" href="/"><img src="/b.jpg"></a>`, nil},
+		{"nested", "https://example.com/", `
+<article class="h-entry"><a class="p-author h-card" href="/"><img src="/jane.jpg"></a></article>`, nil},
+		{"no base URL", "", `<a class="h-card" href="/"><img src="/jane.jpg"></a>`, nil},
+	}
+
+	for _, td := range tests {
+		td := td
+		check := func(t *testing.T, icons []*Icon) {
+			var images []image
+			for _, icon := range icons {
+				require.Equal(t, SourceMicroformats, icon.Source, "unexpected source")
+				assert.Equal(t, KindLogo, icon.Kind, "unexpected kind")
+				images = append(images, image{icon.URL, icon.Rel, icon.Alt})
+			}
+			assert.ElementsMatch(t, td.x, images, "unexpected images")
+		}
+		var base []string
+		if td.base != "" {
+			base = []string{td.base}
+		}
+		f := New(IgnoreWellKnown, IgnoreManifest, IgnoreBrowserConfig)
+		page := `<html><body>` + td.html + `</body></html>`
+
+		t.Run(td.name+"/reader", func(t *testing.T) {
+			t.Parallel()
+			icons, err := f.FindReader(strings.NewReader(page), base...)
+			require.Nil(t, err, "unexpected error")
+			check(t, icons)
+		})
+		t.Run(td.name+"/node", func(t *testing.T) {
+			t.Parallel()
+			n, err := html.Parse(strings.NewReader(page))
+			require.Nil(t, err, "parse HTML")
+			icons, err := f.FindNode(n, base...)
+			require.Nil(t, err, "unexpected error")
+			check(t, icons)
+		})
+	}
+
+	icons, err := New(IgnoreWellKnown, IgnoreMicroformats).FindReader(strings.NewReader(
+		`<a class="h-card" href="/"><img src="/jane.jpg"></a>`), "https://example.com/")
+	require.Nil(t, err, "unexpected error")
+	assert.Equal(t, 0, len(icons), "unexpected icons")
+}
@@ -0,0 +1,167 @@
+// MIT License
+//
+// Copyright (c) 2024 yulog
+
+package favicon
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	urls "net/url"
+	"strings"
+)
+
+// IgnoreBrowserConfig ignores browserconfig.xml files. Icons in
+// msapplication-* <meta> tags are still found.
+var IgnoreBrowserConfig Option = func(f *Finder) { f.ignoreBrowserConfig = true }
+
+// prefix of Microsoft pinned-site <meta> tags
+const msPrefix = "msapplication-"
+
+// tile images whose size isn't part of their name
+var msTileSizes = map[string]size{
+	"tileimage": {w: 144, h: 144},
+}
+
+// return the size of a tile, e.g. "square70x70logo" or "tileimage". Returns
+// false if name isn't a tile image.
+func msTileSize(name string) (size, bool) {
+	if sz, ok := msTileSizes[name]; ok {
+		return sz, true
+	}
+	if !strings.HasSuffix(name, "logo") {
+		return size{}, false
+	}
+	for _, sz := range parseSizes(name) {
+		if !sz.any {
+			return sz, true
+		}
+	}
+	return size{}, true
+}
+
+// extract icons from msapplication-* <meta> tags. Also returns the URL
+// of browserconfig.xml set by msapplication-config, which is empty if
+// unset, or "none" if browserconfig.xml is disabled.
+func (p *parser) parseMSApplication(tags []metaTag) ([]*Icon, string) {
+	var (
+		icons     []*Icon
+		color     string
+		configURL string
+	)
+	for _, tag := range tags {
+		name := strings.TrimPrefix(tag.prop, msPrefix)
+		switch name {
+		case "tilecolor":
+			color = tag.val
+			continue
+		case "config":
+			if strings.EqualFold(tag.val, "none") {
+				configURL = "none"
+			} else {
+				configURL = p.absURL(tag.val)
+			}
+			continue
+		}
+
+		sz, ok := msTileSize(name)
+		if !ok {
+			continue
+		}
+		url := p.absURL(tag.val)
+		if url == "" {
+			continue
+		}
+		icon := &Icon{URL: url, Width: sz.w, Height: sz.h, Kind: KindAppIcon}
+		icon.addProvenance(Provenance{Source: SourceMSApplication, Rel: tag.prop, Origin: tag.origin})
+		p.find.log.Printf("(msapplication) %s", icon.URL)
+		icons = append(icons, icon)
+	}
+	for _, icon := range icons {
+		icon.Color = color
+	}
+	return icons, configURL
+}
+
+// BrowserConfig is a parsed browserconfig.xml file, which describes the
+// tiles of sites pinned to the Windows Start menu.
+type BrowserConfig struct {
+	// Tile images in document order.
+	Tiles []BrowserConfigTile
+	// Background color of tiles, e.g. "#2b5797". May be empty.
+	TileColor string
+}
+
+// BrowserConfigTile is a tile image in browserconfig.xml.
+type BrowserConfigTile struct {
+	Name string // element name, e.g. "square150x150logo" or "TileImage"
+	URL  string // absolute if the file's URL is known
+}
+
+// ParseBrowserConfig parses browserconfig.xml read from r. Relative URLs
+// are resolved against configURL, which may be empty.
+func ParseBrowserConfig(r io.Reader, configURL string) (*BrowserConfig, error) {
+	var v struct {
+		Tile struct {
+			Elements []struct {
+				XMLName xml.Name
+				Src     string `xml:"src,attr"`
+				Text    string `xml:",chardata"`
+			} `xml:",any"`
+		} `xml:"msapplication>tile"`
+	}
+	if err := xml.NewDecoder(r).Decode(&v); err != nil {
+		return nil, fmt.Errorf("decode browserconfig: %w", err)
+	}
+
+	base, _ := urls.Parse(configURL)
+	bc := &BrowserConfig{}
+	for _, el := range v.Tile.Elements {
+		name := el.XMLName.Local
+		if strings.EqualFold(name, "TileColor") {
+			bc.TileColor = strings.TrimSpace(el.Text)
+			continue
+		}
+		src := strings.TrimSpace(el.Src)
+		if src == "" {
+			continue
+		}
+		if base != nil {
+			if u, err := base.Parse(src); err == nil {
+				src = u.String()
+			}
+		}
+		bc.Tiles = append(bc.Tiles, BrowserConfigTile{Name: name, URL: src})
+	}
+	return bc, nil
+}
+
+// retrieve browserconfig.xml and extract tile images
+func (p *parser) parseBrowserConfig(ctx context.Context, url string) ([]*Icon, error) {
+	p.find.log.Printf("loading browserconfig %q ...", url)
+	rc, err := p.find.fetchURL(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	bc, err := ParseBrowserConfig(rc, url)
+	if err != nil {
+		return nil, err
+	}
+
+	var icons []*Icon
+	for _, tile := range bc.Tiles {
+		sz, ok := msTileSize(strings.ToLower(tile.Name))
+		if !ok {
+			continue
+		}
+		icon := &Icon{URL: tile.URL, Width: sz.w, Height: sz.h, Color: bc.TileColor, Kind: KindAppIcon}
+		icon.addProvenance(Provenance{Source: SourceBrowserConfig, Rel: tile.Name, Origin: url})
+		p.find.log.Printf("(browserconfig) %s", icon.URL)
+		icons = append(icons, icon)
+	}
+	return icons, nil
+}
@@ -0,0 +1,121 @@
+// MIT License
+//
+// Copyright (c) 2024 yulog
+
+package favicon
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testBrowserConfig = `<?xml version="1.0" encoding="utf-8"?>
+<browserconfig>
+  <msapplication>
+    <tile>
+      <square70x70logo src="tiny.png"/>
+      <square150x150logo src="/tiles/square.png"/>
+      <wide310x150logo src="/tiles/wide.png"/>
+      <TileColor>#2b5797</TileColor>
+    </tile>
+  </msapplication>
+</browserconfig>`
+
+// TestParseBrowserConfig verifies parsing of browserconfig.xml.
+func TestParseBrowserConfig(t *testing.T) {
+	t.Parallel()
+	bc, err := ParseBrowserConfig(strings.NewReader(testBrowserConfig), "https://example.com/ie/browserconfig.xml")
+	require.Nil(t, err, "unexpected error")
+	assert.Equal(t, "#2b5797", bc.TileColor, "unexpected color")
+	assert.Equal(t, []BrowserConfigTile{
+		{"square70x70logo", "https://example.com/ie/tiny.png"},
+		{"square150x150logo", "https://example.com/tiles/square.png"},
+		{"wide310x150logo", "https://example.com/tiles/wide.png"},
+	}, bc.Tiles, "unexpected tiles")
+
+	_, err = ParseBrowserConfig(strings.NewReader(`<browserconfig>`), "")
+	assert.NotNil(t, err, "expected error")
+}
+
+// TestMSApplication verifies icons from msapplication-* tags and
+// browserconfig.xml.
+func TestMSApplication(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		config   string // msapplication-config value
+		xconfig  string // expected browserconfig URL path
+		xbrowser int    // expected browserconfig icons
+	}{
+		{"declared", "/ie/config.xml", "/ie/config.xml", 3},
+		{"default", "", "/browserconfig.xml", 3},
+		{"none", "none", "", 0},
+	}
+
+	for _, td := range tests {
+		td := td
+		t.Run(td.name, func(t *testing.T) {
+			t.Parallel()
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/":
+					html := `<html><head>
+<meta name="msapplication-TileImage" content="/mstile-144x144.png">
+<meta name="msapplication-square310x310logo" content="/large.png">
+<meta name="msapplication-TileColor" content="#da532c">`
+					if td.config != "" {
+						html += `<meta name="msapplication-config" content="` + td.config + `">`
+					}
+					_, _ = w.Write([]byte(html + `</head></html>`))
+				case td.xconfig:
+					w.Header().Set("Content-Type", "application/xml")
+					_, _ = w.Write([]byte(testBrowserConfig))
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer ts.Close()
+
+			f := New(WithClient(ts.Client()), WithLogger(debugLogger{}), IgnoreManifest, IgnoreWellKnown)
+			res, err := f.FindDetailed(ts.URL + "/")
+			require.Nil(t, err, "unexpected error")
+			assert.Equal(t, 2, res.Report(SourceMSApplication).Count, "unexpected msapplication count")
+
+			sr := res.Report(SourceBrowserConfig)
+			if td.xconfig == "" {
+				assert.Nil(t, sr, "browserconfig retrieved")
+			} else {
+				require.NotNil(t, sr, "missing browserconfig report")
+				assert.Equal(t, ts.URL+td.xconfig, sr.URL, "unexpected browserconfig URL")
+				assert.Equal(t, td.xbrowser, sr.Count, "unexpected browserconfig count")
+			}
+			require.Equal(t, 2+td.xbrowser, len(res.Icons), "unexpected favicon count")
+
+			byURL := map[string]*Icon{}
+			for _, icon := range res.Icons {
+				byURL[strings.TrimPrefix(icon.URL, ts.URL)] = icon
+			}
+			icon := byURL["/mstile-144x144.png"]
+			require.NotNil(t, icon, "missing TileImage")
+			assert.Equal(t, SourceMSApplication, icon.Source, "unexpected source")
+			assert.Equal(t, "msapplication-tileimage", icon.Rel, "unexpected rel")
+			assert.Equal(t, 144, icon.Width, "unexpected width")
+			assert.Equal(t, "#da532c", icon.Color, "unexpected color")
+			assert.Equal(t, 310, byURL["/large.png"].Height, "unexpected height")
+
+			if td.xbrowser > 0 {
+				icon = byURL["/tiles/wide.png"]
+				require.NotNil(t, icon, "missing wide tile")
+				assert.Equal(t, SourceBrowserConfig, icon.Source, "unexpected source")
+				assert.Equal(t, 310, icon.Width, "unexpected width")
+				assert.Equal(t, 150, icon.Height, "unexpected height")
+				assert.Equal(t, "#2b5797", icon.Color, "unexpected color")
+			}
+		})
+	}
+}
@@ -4,42 +4,84 @@
 
 package favicon
 
-import "strconv"
+import (
+	"strconv"
+	"strings"
+)
 
-func (p *parser) parseOpenGraph(kv []string) []*Icon {
+// structured properties of one og:image or twitter:image, keyed by the
+// part of the property after the image prefix, e.g. "width". The URL
+// is keyed "url" whichever alias declared it.
+type metaGroup map[string]metaTag
+
+// group <meta> tags into images following the Open Graph rules for
+// structured properties and arrays (https://ogp.me/#array): each image
+// starts with its URL and includes the properties that follow it.
+// Properties may also precede the URL, so a new image is only started
+// when a property is repeated with a different value. prefix is the
+// root property, e.g. "og:image"; aliases of it, e.g. "og:image:url",
+// are passed in roots.
+func groupMetaTags(tags []metaTag, prefix string, roots ...string) []metaGroup {
 	var (
-		icons []*Icon
-		icon  *Icon
+		groups []metaGroup
+		cur    = metaGroup{}
 	)
-
-	for i := 0; i < len(kv)-1; i += 2 {
-		k, v := kv[i], kv[i+1]
-		switch k {
-		case "og:image":
-			if icon != nil {
-				icons = append(icons, icon)
-			}
-			icon = &Icon{URL: v}
-			p.find.log.Printf("(opengraph) %s", icon.URL)
-		case "og:image:type":
-			if icon != nil {
-				icon.MimeType = v
-			}
-		case "og:image:width":
-			if icon != nil {
-				if n, err := strconv.ParseInt(v, 10, 32); err == nil {
-					icon.Width = int(n)
-				}
-			}
-		case "og:image:height":
-			if icon != nil {
-				if n, err := strconv.ParseInt(v, 10, 32); err == nil {
-					icon.Height = int(n)
-				}
+	for _, tag := range tags {
+		key := strings.TrimPrefix(strings.TrimPrefix(tag.prop, prefix), ":")
+		if key == "" {
+			key = "url"
+		}
+		for _, s := range roots {
+			if tag.prop == s {
+				key = "url"
 			}
 		}
+		if v, ok := cur[key]; ok && v.val != tag.val {
+			groups = append(groups, cur)
+			cur = metaGroup{}
+		}
+		if _, ok := cur[key]; !ok {
+			cur[key] = tag
+		}
 	}
-	if icon != nil {
+	if len(cur) > 0 {
+		groups = append(groups, cur)
+	}
+	return groups
+}
+
+// return integer value of property or 0
+func (g metaGroup) int(key string) int {
+	if n, err := strconv.ParseInt(g[key].val, 10, 32); err == nil && n > 0 {
+		return int(n)
+	}
+	return 0
+}
+
+func (p *parser) parseOpenGraph(tags []metaTag) []*Icon {
+	var (
+		icons []*Icon
+		https = p.baseURL != nil && p.baseURL.Scheme == "https"
+	)
+	for _, g := range groupMetaTags(tags, "og:image", "og:image:url") {
+		// prefer secure_url on https pages, and if it's the only URL
+		tag, ok := g["url"]
+		if v, ok2 := g["secure_url"]; ok2 && (https || !ok) {
+			tag, ok = v, true
+		}
+		if !ok {
+			continue
+		}
+		icon := &Icon{
+			URL:      tag.val,
+			MimeType: g["type"].val,
+			Width:    g.int("width"),
+			Height:   g.int("height"),
+			Alt:      g["alt"].val,
+			Kind:     KindSocialImage,
+		}
+		icon.addProvenance(Provenance{Source: SourceOpenGraph, Rel: tag.prop, Origin: tag.origin})
+		p.find.log.Printf("(opengraph) %s", icon.URL)
 		icons = append(icons, icon)
 	}
 	return icons
@@ -0,0 +1,151 @@
+// MIT License
+//
+// Copyright (c) 2024 yulog
+
+package favicon
+
+import (
+	urls "net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestOpenGraph verifies Open Graph structured properties and arrays.
+func TestOpenGraph(t *testing.T) {
+	t.Parallel()
+	type image struct {
+		url    string
+		w, h   int
+		typ    string
+		alt    string
+		source string // property URL was taken from
+	}
+	tests := []struct {
+		name  string
+		page  string
+		props [][2]string
+		x     []image
+	}{
+		{"simple", "http://example.com/", [][2]string{
+			{"og:image", "a.png"},
+			{"og:image:width", "100"},
+			{"og:image:height", "50"},
+			{"og:image:type", "image/png"},
+			{"og:image:alt", "Logo"},
+		}, []image{{"a.png", 100, 50, "image/png", "Logo", "og:image"}}},
+		{"array", "http://example.com/", [][2]string{
+			{"og:image", "a.png"},
+			{"og:image:width", "100"},
+			{"og:image", "b.png"},
+			{"og:image", "c.png"},
+			{"og:image:width", "300"},
+		}, []image{
+			{"a.png", 100, 0, "", "", "og:image"},
+			{"b.png", 0, 0, "", "", "og:image"},
+			{"c.png", 300, 0, "", "", "og:image"},
+		}},
+		{"properties first", "http://example.com/", [][2]string{
+			{"og:image:width", "100"},
+			{"og:image:height", "50"},
+			{"og:image", "a.png"},
+			{"og:image:width", "200"},
+			{"og:image", "b.png"},
+		}, []image{
+			{"a.png", 100, 50, "", "", "og:image"},
+			{"b.png", 200, 0, "", "", "og:image"},
+		}},
+		{"url alias", "http://example.com/", [][2]string{
+			{"og:image", "a.png"},
+			{"og:image:url", "a.png"},
+			{"og:image:width", "100"},
+			{"og:image:url", "b.png"},
+		}, []image{
+			{"a.png", 100, 0, "", "", "og:image"},
+			{"b.png", 0, 0, "", "", "og:image:url"},
+		}},
+		{"secure_url http", "http://example.com/", [][2]string{
+			{"og:image", "http://cdn.example.com/a.png"},
+			{"og:image:secure_url", "https://cdn.example.com/a.png"},
+		}, []image{{"http://cdn.example.com/a.png", 0, 0, "", "", "og:image"}}},
+		{"secure_url https", "https://example.com/", [][2]string{
+			{"og:image", "http://cdn.example.com/a.png"},
+			{"og:image:secure_url", "https://cdn.example.com/a.png"},
+		}, []image{{"https://cdn.example.com/a.png", 0, 0, "", "", "og:image:secure_url"}}},
+		{"secure_url only", "http://example.com/", [][2]string{
+			{"og:image:secure_url", "https://cdn.example.com/a.png"},
+		}, []image{{"https://cdn.example.com/a.png", 0, 0, "", "", "og:image:secure_url"}}},
+		{"no url", "http://example.com/", [][2]string{
+			{"og:image:width", "100"},
+		}, nil},
+	}
+
+	for _, td := range tests {
+		td := td
+		t.Run(td.name, func(t *testing.T) {
+			t.Parallel()
+			p := New().newParser()
+			u, err := urls.Parse(td.page)
+			require.Nil(t, err, "parse URL")
+			p.baseURL = u
+
+			var tags []metaTag
+			for _, prop := range td.props {
+				tags = append(tags, metaTag{prop: prop[0], val: prop[1]})
+			}
+			var images []image
+			for _, icon := range p.parseOpenGraph(tags) {
+				assert.Equal(t, KindSocialImage, icon.Kind, "unexpected kind")
+				images = append(images, image{icon.URL, icon.Width, icon.Height,
+					icon.MimeType, icon.Alt, icon.Provenance[0].Rel})
+			}
+			assert.Equal(t, td.x, images, "unexpected images")
+		})
+	}
+}
+
+// TestTwitterCard verifies Twitter images and card types.
+func TestTwitterCard(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name  string
+		html  string
+		x     int    // expected social images
+		xcard string // expected card of first image
+		xalt  string // expected alt text of first image
+		xtype string // expected MIME type of first image
+	}{
+		{"summary", `<meta name="twitter:card" content="summary">
+<meta name="twitter:image:alt" content="Logo">
+<meta name="twitter:image" content="/logo.png">`, 1, TwitterCardSummary, "Logo", "image/png"},
+		{"large image", `<meta name="twitter:image" content="/banner.jpg">
+<meta name="twitter:card" content="summary_large_image">`, 1, TwitterCardSummaryLargeImage, "", "image/jpeg"},
+		// Twitter falls back to og:image, whose type is also used for
+		// the twitter:image with the same URL
+		{"og fallback", `<meta name="twitter:card" content="summary">
+<meta property="og:image" content="/image?id=1">
+<meta property="og:image:type" content="image/png">`, 1, TwitterCardSummary, "", "image/png"},
+		{"og type", `<meta property="og:image" content="/image?id=1">
+<meta property="og:image:type" content="image/png">
+<meta property="og:image:alt" content="Banner">
+<meta name="twitter:image" content="/image?id=1">`, 1, "", "Banner", "image/png"},
+		{"no card", `<meta name="twitter:image" content="/banner.jpg">`, 1, "", "", "image/jpeg"},
+	}
+
+	for _, td := range tests {
+		td := td
+		t.Run(td.name, func(t *testing.T) {
+			t.Parallel()
+			icons, err := New(IgnoreWellKnown).FindReader(strings.NewReader(`<html><head>` + td.html + `</head></html>`))
+			require.Nil(t, err, "unexpected error")
+			require.Equal(t, td.x, len(icons), "unexpected icon count")
+			icon := icons[0]
+			assert.Equal(t, KindSocialImage, icon.Kind, "unexpected kind")
+			assert.Equal(t, td.xcard, icon.TwitterCard, "unexpected card")
+			assert.Equal(t, td.xalt, icon.Alt, "unexpected alt")
+			assert.Equal(t, td.xtype, icon.MimeType, "unexpected MIME type")
+		})
+	}
+}
@@ -0,0 +1,150 @@
+// MIT License
+//
+// Copyright (c) 2024 yulog
+
+package favicon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// Source identifies a place where a Finder looks for icons.
+type Source string
+
+// Sources searched by Finder.
+const (
+	SourceLink      Source = "link"       // <link> tags in HTML
+	SourceOpenGraph Source = "opengraph"  // Open Graph <meta> tags
+	SourceTwitter   Source = "twitter"    // Twitter <meta> tags
+	SourceManifest  Source = "manifest"   // JSON manifest
+	SourceWellKnown Source = "well-known" // common paths, e.g. /favicon.ico
+
+	SourceMSApplication Source = "msapplication" // msapplication-* <meta> tags
+	SourceBrowserConfig Source = "browserconfig" // browserconfig.xml
+	SourceJSONLD        Source = "json-ld"       // schema.org JSON-LD
+	SourceMicrodata     Source = "microdata"     // schema.org microdata
+	SourceMicroformats  Source = "microformats"  // h-card microformats
+)
+
+// Result is the detailed outcome of a search for icons, returned by
+// FindDetailed().
+type Result struct {
+	// URL of the searched page. If the page was retrieved via HTTP,
+	// this is the final URL after following any redirects. Empty if no
+	// URL is known.
+	URL string `json:"url"`
+	// URLs that were redirected before reaching URL, starting with the
+	// one passed to FindDetailed(). Empty if there were no redirects.
+	Redirects []string `json:"redirects,omitempty"`
+	// Character encoding of the page, e.g. "utf-8" or "shift_jis",
+	// determined from the Content-Type header, byte order mark or <meta>
+	// tags. Empty if unknown.
+	Charset string `json:"charset,omitempty"`
+	// Icons found in all sources, filtered and sorted as by Find().
+	Icons []*Icon `json:"icons"`
+	// Open Graph and Twitter images, filtered and sorted like Icons.
+	// Only set if the Finder was created with SeparateSocialImages;
+	// otherwise they are in Icons.
+	SocialImages []*Icon `json:"social_images,omitempty"`
+	// Reports for each source that was searched, in the order they were
+	// searched. Sources disabled by options, e.g. IgnoreManifest, are
+	// absent.
+	Reports []*SourceReport `json:"sources"`
+}
+
+// Report returns the first report for the given source, or nil if the
+// source wasn't searched.
+func (r *Result) Report(source Source) *SourceReport {
+	for _, sr := range r.Reports {
+		if sr.Source == source {
+			return sr
+		}
+	}
+	return nil
+}
+
+// SourceReport describes the outcome of searching a single source.
+type SourceReport struct {
+	Source Source `json:"source"`
+	// URL retrieved for remote sources (manifest, browserconfig.xml and
+	// well-known paths).
+	URL string `json:"url,omitempty"`
+	// Number of icons the source provided, before removing duplicates
+	// and applying filters.
+	Count int `json:"count"`
+	// Error encountered while searching source, if any. Use errors.As
+	// to check for *HTTPError or *json.SyntaxError, and IsTimeout to
+	// check for timeouts. Encoded as its message in JSON, so errors
+	// decoded from JSON (e.g. cached results) lose their type.
+	Err error `json:"-"`
+	// Skipped is true if the source wasn't retrieved because robots.txt
+	// disallows it. See WithRobots.
+	Skipped bool `json:"skipped,omitempty"`
+}
+
+// OK returns true if the source was searched without error.
+func (sr *SourceReport) OK() bool { return sr.Err == nil }
+
+// MarshalJSON implements json.Marshaler.
+func (sr *SourceReport) MarshalJSON() ([]byte, error) {
+	type report SourceReport
+	return json.Marshal(struct {
+		*report
+		Error string `json:"error,omitempty"`
+	}{(*report)(sr), errorString(sr.Err)})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (sr *SourceReport) UnmarshalJSON(data []byte) error {
+	type report SourceReport
+	v := struct {
+		*report
+		Error string `json:"error,omitempty"`
+	}{report: (*report)(sr)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	sr.Err = stringError(v.Error)
+	return nil
+}
+
+// HTTPError is returned when a server responds with a non-2xx status.
+type HTTPError struct {
+	URL        string // URL that was requested
+	StatusCode int    // e.g. 404
+	Status     string // e.g. "404 Not Found"
+}
+
+// Error implements error.
+func (err *HTTPError) Error() string {
+	return fmt.Sprintf("[%d] %s", err.StatusCode, err.Status)
+}
+
+// return the message of err, or "" if err is nil
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// return an error with message s, or nil if s is empty
+func stringError(s string) error {
+	if s == "" {
+		return nil
+	}
+	return errors.New(s)
+}
+
+// IsTimeout returns true if err was caused by a request timing out.
+func IsTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var nerr net.Error
+	return errors.As(err, &nerr) && nerr.Timeout()
+}
@@ -0,0 +1,156 @@
+// MIT License
+//
+// Copyright (c) 2024 yulog
+
+package favicon
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestFindDetailed verifies per-source reports.
+func TestFindDetailed(t *testing.T) {
+	t.Parallel()
+	ts := httptest.NewServer(http.FileServer(http.Dir("./testdata/no-markup")))
+	defer ts.Close()
+
+	f := New(WithClient(ts.Client()), WithLogger(debugLogger{}), WithWellKnownPaths("favicon.ico", "apple-touch-icon.png"))
+	res, err := f.FindDetailed(ts.URL + "/index.html")
+	require.Nil(t, err, "unexpected error")
+	assert.Equal(t, 3, len(res.Icons), "unexpected favicon count")
+	// http.FileServer redirects /index.html to /
+	assert.Equal(t, ts.URL+"/", res.URL, "unexpected URL")
+	assert.Equal(t, []string{ts.URL + "/index.html"}, res.Redirects, "unexpected redirects")
+
+	sources := []Source{}
+	for _, sr := range res.Reports {
+		sources = append(sources, sr.Source)
+	}
+	assert.Equal(t, []Source{
+		SourceLink, SourceOpenGraph, SourceTwitter, SourceMSApplication,
+		SourceJSONLD, SourceMicrodata, SourceMicroformats,
+		SourceManifest, SourceBrowserConfig, SourceWellKnown, SourceWellKnown,
+	}, sources, "unexpected sources")
+
+	sr := res.Report(SourceManifest)
+	require.NotNil(t, sr, "missing manifest report")
+	assert.True(t, sr.OK(), "unexpected error: %v", sr.Err)
+	assert.Equal(t, 2, sr.Count, "unexpected manifest icon count")
+
+	// /favicon.ico exists, /apple-touch-icon.png doesn't
+	n := len(res.Reports)
+	assert.Nil(t, res.Reports[n-2].Err, "unexpected error")
+	var herr *HTTPError
+	require.True(t, errors.As(res.Reports[n-1].Err, &herr), "expected HTTPError")
+	assert.Equal(t, http.StatusNotFound, herr.StatusCode, "unexpected status")
+}
+
+// TestFindDetailedMalformed verifies that malformed manifests are
+// distinguished from missing ones.
+func TestFindDetailedMalformed(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		manifest string
+		status   int
+	}{
+		{"missing", "", http.StatusNotFound},
+		{"malformed", `{"icons": ]}`, http.StatusOK},
+	}
+
+	for _, td := range tests {
+		td := td
+		t.Run(td.name, func(t *testing.T) {
+			t.Parallel()
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/":
+					_, _ = w.Write([]byte(`<html><head><link rel="manifest" href="/app.json"></head></html>`))
+				case "/app.json":
+					w.WriteHeader(td.status)
+					_, _ = w.Write([]byte(td.manifest))
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer ts.Close()
+
+			f := New(WithClient(ts.Client()), WithLogger(debugLogger{}), IgnoreWellKnown)
+			res, err := f.FindDetailed(ts.URL + "/")
+			require.Nil(t, err, "unexpected error")
+			sr := res.Report(SourceManifest)
+			require.NotNil(t, sr, "missing manifest report")
+			assert.Equal(t, ts.URL+"/app.json", sr.URL, "unexpected manifest URL")
+			require.NotNil(t, sr.Err, "expected error")
+
+			var (
+				herr *HTTPError
+				jerr *json.SyntaxError
+			)
+			if td.status == http.StatusNotFound {
+				assert.True(t, errors.As(sr.Err, &herr), "expected HTTPError, got %v", sr.Err)
+			} else {
+				assert.False(t, errors.As(sr.Err, &herr), "unexpected HTTPError")
+				assert.True(t, errors.As(sr.Err, &jerr), "expected SyntaxError, got %#v", sr.Err)
+			}
+			assert.False(t, IsTimeout(sr.Err), "unexpected timeout")
+		})
+	}
+}
+
+// TestRedirect verifies that the final URL after redirects is used to
+// resolve links and probe well-known paths.
+func TestRedirect(t *testing.T) {
+	t.Parallel()
+	var (
+		mu        sync.Mutex
+		requested []string
+	)
+	final := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested = append(requested, r.URL.Path)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/en/":
+			_, _ = w.Write([]byte(`<html><head><link rel="icon" href="icon.png"></head></html>`))
+		case "/favicon.ico":
+			_, _ = w.Write([]byte{0, 0, 1, 0})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer final.Close()
+	start := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			http.Redirect(w, r, "/home", http.StatusMovedPermanently)
+		case "/home":
+			http.Redirect(w, r, final.URL+"/en/", http.StatusFound)
+		default:
+			t.Errorf("unexpected request: %s", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer start.Close()
+
+	f := New(WithLogger(debugLogger{}), WithConcurrency(1), WithWellKnownPaths("favicon.ico", "apple-touch-icon.png"))
+	res, err := f.FindDetailed(start.URL + "/")
+	require.Nil(t, err, "unexpected error")
+	assert.Equal(t, final.URL+"/en/", res.URL, "unexpected URL")
+	assert.Equal(t, []string{start.URL + "/", start.URL + "/home"}, res.Redirects, "unexpected redirects")
+
+	urls := []string{}
+	for _, icon := range res.Icons {
+		urls = append(urls, icon.URL)
+	}
+	assert.ElementsMatch(t, []string{final.URL + "/en/icon.png", final.URL + "/favicon.ico"}, urls, "unexpected icons")
+	assert.Equal(t, []string{"/en/", "/manifest.json", "/browserconfig.xml", "/favicon.ico", "/apple-touch-icon.png"}, requested, "unexpected requests")
+}
@@ -0,0 +1,310 @@
+// MIT License
+//
+// Copyright (c) 2024 yulog
+
+package favicon
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	urls "net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrDisallowed is returned for requests that robots.txt disallows. Sources
+// skipped because of robots.txt are marked as Skipped in SourceReports
+// rather than failed.
+var ErrDisallowed = errors.New("disallowed by robots.txt")
+
+const (
+	// how long retrieved or missing robots.txt files are kept
+	robotsTTL = 24 * time.Hour
+	// robots.txt files are truncated to this size
+	maxRobotsSize = 500 << 10
+	// how often expired robots.txt files are removed
+	robotsSweepInterval = 10 * time.Minute
+)
+
+// WithRobots configures Finder to obey robots.txt. Each host's robots.txt
+// is retrieved once and kept for 24 hours, and every request is checked
+// against the rules for token, e.g. "go-favicon". If token is empty, the
+// product name from UserAgent is used.
+//
+// As recommended by RFC 9309, a missing robots.txt (status 4xx) allows all
+// requests, and an unreachable one (status 5xx or a network error)
+// disallows all requests to the host. Unreachable robots.txt files are
+// retried after the error TTL (see WithCacheErrorTTL), or by the next
+// search if retrieval timed out. Redirects are not checked.
+func WithRobots(token string) Option {
+	return func(f *Finder) {
+		f.robots = &robotsChecker{token: token, hosts: map[string]*robotsEntry{}}
+	}
+}
+
+// robotsChecker retrieves and caches robots.txt for each host.
+type robotsChecker struct {
+	token string
+
+	mu        sync.Mutex
+	hosts     map[string]*robotsEntry // keyed by scheme://host
+	nextSweep time.Time               // when to next remove expired entries
+}
+
+type robotsEntry struct {
+	ready   chan struct{} // closed when rules is set or retrieval fails
+	rules   *robotsRules  // nil if retrieval was cancelled
+	expires time.Time
+}
+
+// remove expired entries. rc.mu must be held.
+func (rc *robotsChecker) sweep(now time.Time) {
+	if now.Before(rc.nextSweep) {
+		return
+	}
+	rc.nextSweep = now.Add(robotsSweepInterval)
+	for root, e := range rc.hosts {
+		if isClosed(e.ready) && now.After(e.expires) {
+			delete(rc.hosts, root)
+		}
+	}
+}
+
+// return the user-agent token to match in robots.txt
+func (rc *robotsChecker) userAgent() string {
+	if rc.token != "" {
+		return rc.token
+	}
+	// product name of UserAgent, e.g. "go-favicon" for "go-favicon/0.1"
+	token, _, _ := strings.Cut(UserAgent, " ")
+	token, _, _ = strings.Cut(token, "/")
+	return token
+}
+
+// return ErrDisallowed if robots.txt disallows retrieving url
+func (f *Finder) checkRobots(ctx context.Context, url string) error {
+	u, err := urls.Parse(url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Path == "/robots.txt" {
+		return nil
+	}
+	rules, err := f.robotsRules(ctx, u.Scheme+"://"+u.Host)
+	if err != nil {
+		return err
+	}
+	if !rules.allowed(f.robots.userAgent(), u.RequestURI()) {
+		f.log.Printf("(robots) disallowed: %s", url)
+		return fmt.Errorf("%w: %s", ErrDisallowed, url)
+	}
+	return nil
+}
+
+// return rules for root (scheme://host), retrieving robots.txt if necessary
+func (f *Finder) robotsRules(ctx context.Context, root string) (*robotsRules, error) {
+	rc := f.robots
+	for {
+		rc.mu.Lock()
+		now := time.Now()
+		rc.sweep(now)
+		e, ok := rc.hosts[root]
+		if !ok || (isClosed(e.ready) && now.After(e.expires)) {
+			e = &robotsEntry{ready: make(chan struct{})}
+			rc.hosts[root] = e
+			rc.mu.Unlock()
+
+			rules, ttl := f.fetchRobots(ctx, root+"/robots.txt")
+			rc.mu.Lock()
+			err := ctx.Err()
+			switch {
+			case err != nil:
+				// a cancelled request says nothing about the host, so
+				// waiters retry with their own contexts
+				if rc.hosts[root] == e {
+					delete(rc.hosts, root)
+				}
+			case ttl <= 0:
+				// waiters share the rules, but the next search retries
+				if rc.hosts[root] == e {
+					delete(rc.hosts, root)
+				}
+				e.rules = rules
+			default:
+				e.rules, e.expires = rules, time.Now().Add(ttl)
+			}
+			rc.mu.Unlock()
+			close(e.ready)
+			if err != nil {
+				return nil, err
+			}
+			return rules, nil
+		}
+		rc.mu.Unlock()
+
+		select {
+		case <-e.ready:
+			if e.rules != nil {
+				return e.rules, nil
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// retrieve and parse robots.txt. Also returns how long to keep the rules,
+// which is 0 if they shouldn't be kept at all.
+func (f *Finder) fetchRobots(ctx context.Context, url string) (*robotsRules, time.Duration) {
+	resp, err := f.fetchResource(ctx, url)
+	if err != nil {
+		var herr *HTTPError
+		if errors.As(err, &herr) && herr.StatusCode >= 400 && herr.StatusCode < 500 {
+			f.log.Printf("(robots) %s: none", url)
+			return &robotsRules{}, robotsTTL
+		}
+		f.log.Printf("(robots) %s: unreachable: %v", url, err)
+		ttl := f.cacheErrorTTL
+		if IsTimeout(err) {
+			ttl = 0
+		}
+		return &robotsRules{disallowAll: true}, ttl
+	}
+	defer resp.Body.Close()
+
+	rules := parseRobots(io.LimitReader(resp.Body, maxRobotsSize))
+	f.log.Printf("(robots) %s: %d group(s)", url, len(rules.groups))
+	return rules, robotsTTL
+}
+
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// parsed robots.txt
+type robotsRules struct {
+	disallowAll bool
+	groups      []robotsGroup
+}
+
+type robotsGroup struct {
+	agents []string
+	rules  []robotsRule
+}
+
+type robotsRule struct {
+	allow   bool
+	pattern string
+	re      *regexp.Regexp
+}
+
+// parse robots.txt as specified by RFC 9309
+func parseRobots(r io.Reader) *robotsRules {
+	var (
+		rules   = &robotsRules{}
+		g       *robotsGroup
+		inRules bool // whether the current group has rules yet
+		scanner = bufio.NewScanner(r)
+	)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(strings.TrimPrefix(scanner.Text(), "\ufeff"), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// consecutive user-agent lines share a group
+			if g == nil || inRules {
+				rules.groups = append(rules.groups, robotsGroup{})
+				g = &rules.groups[len(rules.groups)-1]
+				inRules = false
+			}
+			g.agents = append(g.agents, value)
+		case "allow", "disallow":
+			if g == nil {
+				continue
+			}
+			inRules = true
+			// an empty pattern matches nothing
+			if value == "" {
+				continue
+			}
+			g.rules = append(g.rules, robotsRule{
+				allow:   key == "allow",
+				pattern: value,
+				re:      robotsPattern(value),
+			})
+		}
+	}
+	return rules
+}
+
+// compile a path pattern. "*" matches any characters and a trailing "$"
+// anchors the pattern at the end of the path.
+func robotsPattern(pattern string) *regexp.Regexp {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+	expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return regexp.MustCompile(expr)
+}
+
+// return true if agent may retrieve path. The longest matching rule wins,
+// and allow rules win ties.
+func (rr *robotsRules) allowed(agent, path string) bool {
+	if rr.disallowAll {
+		return false
+	}
+
+	var (
+		rules   []robotsRule
+		matched bool
+	)
+	for _, g := range rr.groups {
+		for _, a := range g.agents {
+			if strings.EqualFold(a, agent) {
+				rules = append(rules, g.rules...)
+				matched = true
+				break
+			}
+		}
+	}
+	// groups for other agents only apply if none names agent
+	if !matched {
+		for _, g := range rr.groups {
+			for _, a := range g.agents {
+				if a == "*" {
+					rules = append(rules, g.rules...)
+					break
+				}
+			}
+		}
+	}
+
+	var (
+		allow   = true
+		longest = -1
+	)
+	for _, r := range rules {
+		if !r.re.MatchString(path) {
+			continue
+		}
+		if n := len(r.pattern); n > longest || (n == longest && r.allow) {
+			allow, longest = r.allow, n
+		}
+	}
+	return allow
+}
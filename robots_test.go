@@ -0,0 +1,264 @@
+// MIT License
+//
+// Copyright (c) 2024 yulog
+
+package favicon
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseRobots verifies matching of robots.txt rules.
+func TestParseRobots(t *testing.T) {
+	t.Parallel()
+	robots := `# comment
+User-agent: *
+Disallow: /private/
+Allow: /private/public/
+
+User-agent: go-favicon
+User-agent: OtherBot
+Disallow: /*.ico$
+Disallow: /static/
+Allow: /static/icons/
+
+User-agent: emptybot
+Disallow:
+`
+	rules := parseRobots(strings.NewReader(robots))
+	tests := []struct {
+		agent, path string
+		x           bool
+	}{
+		{"somebot", "/", true},
+		{"somebot", "/private/x", false},
+		{"somebot", "/private/public/x", true},
+		{"somebot", "/favicon.ico", true},
+		{"go-favicon", "/favicon.ico", false},
+		{"Go-Favicon", "/favicon.ico", false},
+		{"go-favicon", "/favicon.ico?v=2", true},
+		{"go-favicon", "/private/x", true}, // * group doesn't apply
+		{"otherbot", "/static/app.css", false},
+		{"otherbot", "/static/icons/a.png", true},
+		{"emptybot", "/private/x", true},
+	}
+	for _, td := range tests {
+		assert.Equal(t, td.x, rules.allowed(td.agent, td.path), "%s %s", td.agent, td.path)
+	}
+
+	assert.False(t, (&robotsRules{disallowAll: true}).allowed("go-favicon", "/"), "disallowAll allowed")
+}
+
+// TestRobots verifies that disallowed sources are skipped.
+func TestRobots(t *testing.T) {
+	t.Parallel()
+	var (
+		mu   sync.Mutex
+		hits = map[string]int{}
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/robots.txt":
+			_, _ = w.Write([]byte("User-agent: go-favicon\nDisallow: /manifest.json\nDisallow: /apple-touch-icon\nDisallow: /secret\n"))
+		case "/", "/secret":
+			_, _ = w.Write([]byte(`<html><head><link rel="icon" href="/icon.png"></head></html>`))
+		case "/favicon.ico":
+			_, _ = w.Write(encodeImage(t, "png", 16, 16))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	count := func(path string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return hits[path]
+	}
+
+	f := New(WithClient(ts.Client()), WithLogger(debugLogger{}), WithRobots(""))
+	for i := 0; i < 2; i++ {
+		res, err := f.FindDetailed(ts.URL + "/")
+		require.Nil(t, err, "unexpected error")
+		assert.Equal(t, 2, len(res.Icons), "unexpected favicon count")
+
+		sr := res.Report(SourceManifest)
+		require.NotNil(t, sr, "missing manifest report")
+		assert.True(t, sr.Skipped, "manifest not skipped")
+		assert.True(t, sr.OK(), "skipped source reported as error")
+		for _, sr := range res.Reports {
+			if sr.Source == SourceWellKnown {
+				assert.Equal(t, strings.Contains(sr.URL, "/apple-touch-icon"), sr.Skipped, "unexpected skip: %s", sr.URL)
+			}
+		}
+	}
+	assert.Equal(t, 1, count("/robots.txt"), "robots.txt not cached")
+	assert.Equal(t, 0, count("/manifest.json"), "disallowed manifest retrieved")
+	assert.Equal(t, 0, count("/apple-touch-icon.png"), "disallowed icon retrieved")
+
+	_, err := f.Find(ts.URL + "/secret")
+	assert.True(t, errors.Is(err, ErrDisallowed), "expected ErrDisallowed, got %v", err)
+	assert.Equal(t, 0, count("/secret"), "disallowed page retrieved")
+
+	// other tokens aren't restricted
+	f = New(WithClient(ts.Client()), WithLogger(debugLogger{}), WithRobots("otherbot"))
+	res, err := f.FindDetailed(ts.URL + "/secret")
+	require.Nil(t, err, "unexpected error")
+	assert.False(t, res.Report(SourceManifest).Skipped, "manifest skipped")
+}
+
+// TestRobotsUnreachable verifies that server errors disallow everything.
+func TestRobotsUnreachable(t *testing.T) {
+	t.Parallel()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`<html></html>`))
+	}))
+	defer ts.Close()
+
+	f := New(WithClient(ts.Client()), WithLogger(debugLogger{}), WithRobots(""))
+	_, err := f.Find(ts.URL + "/")
+	assert.True(t, errors.Is(err, ErrDisallowed), "expected ErrDisallowed, got %v", err)
+}
+
+// TestRobotsRetry verifies that unreachable robots.txt files are retried
+// after the error TTL, and timeouts by the next search.
+func TestRobotsRetry(t *testing.T) {
+	t.Parallel()
+	t.Run("server error", func(t *testing.T) {
+		t.Parallel()
+		var (
+			mu       sync.Mutex
+			requests int
+		)
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/robots.txt" {
+				mu.Lock()
+				requests++
+				n := requests
+				mu.Unlock()
+				if n == 1 {
+					http.Error(w, "unavailable", http.StatusServiceUnavailable)
+					return
+				}
+				http.NotFound(w, r)
+				return
+			}
+			_, _ = w.Write([]byte(`<html></html>`))
+		}))
+		defer ts.Close()
+
+		f := New(WithClient(ts.Client()), WithLogger(debugLogger{}), WithRobots(""),
+			WithCacheErrorTTL(100*time.Millisecond))
+		_, err := f.Find(ts.URL + "/")
+		assert.True(t, errors.Is(err, ErrDisallowed), "expected ErrDisallowed, got %v", err)
+		_, err = f.Find(ts.URL + "/")
+		assert.True(t, errors.Is(err, ErrDisallowed), "expected ErrDisallowed, got %v", err)
+
+		time.Sleep(150 * time.Millisecond)
+		_, err = f.Find(ts.URL + "/")
+		assert.Nil(t, err, "unexpected error")
+		mu.Lock()
+		assert.Equal(t, 2, requests, "unexpected request count")
+		mu.Unlock()
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		t.Parallel()
+		var (
+			mu   sync.Mutex
+			slow = true
+		)
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			wait := slow
+			slow = false
+			mu.Unlock()
+			if wait {
+				<-r.Context().Done()
+				return
+			}
+			_, _ = w.Write([]byte("User-agent: *\nDisallow: /secret\n"))
+		}))
+		defer ts.Close()
+
+		client := *ts.Client()
+		client.Timeout = 100 * time.Millisecond
+		f := New(WithClient(&client), WithLogger(debugLogger{}), WithRobots(""))
+		assert.True(t, errors.Is(f.checkRobots(context.Background(), ts.URL+"/icon.png"), ErrDisallowed),
+			"expected ErrDisallowed")
+		assert.Nil(t, f.checkRobots(context.Background(), ts.URL+"/icon.png"), "timeout kept")
+	})
+}
+
+// TestRobotsCancelled verifies that a cancelled retrieval of robots.txt
+// doesn't affect other searches waiting for it, and that expired entries
+// are removed.
+func TestRobotsCancelled(t *testing.T) {
+	t.Parallel()
+	var (
+		mu       sync.Mutex
+		requests int
+		started  = make(chan struct{})
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		n := requests
+		mu.Unlock()
+		if n == 1 {
+			// hang until the client gives up
+			close(started)
+			<-r.Context().Done()
+			return
+		}
+		_, _ = w.Write([]byte("User-agent: *\nDisallow: /secret\n"))
+	}))
+	defer ts.Close()
+
+	f := New(WithClient(ts.Client()), WithLogger(debugLogger{}), WithRobots(""))
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- f.checkRobots(ctx, ts.URL+"/icon.png") }()
+	<-started
+
+	waiter := make(chan error, 1)
+	go func() { waiter <- f.checkRobots(context.Background(), ts.URL+"/icon.png") }()
+	time.Sleep(50 * time.Millisecond) // let the second search wait
+	cancel()
+
+	assert.True(t, errors.Is(<-errc, context.Canceled), "expected context.Canceled")
+	assert.Nil(t, <-waiter, "unexpected error")
+	assert.True(t, errors.Is(f.checkRobots(context.Background(), ts.URL+"/secret"), ErrDisallowed),
+		"expected ErrDisallowed")
+	mu.Lock()
+	assert.Equal(t, 2, requests, "unexpected request count")
+	mu.Unlock()
+
+	// expired entries are removed when other hosts are looked up
+	rc := f.robots
+	rc.mu.Lock()
+	rc.hosts[ts.URL].expires = time.Now().Add(-time.Second)
+	rc.nextSweep = time.Time{}
+	rc.mu.Unlock()
+	_, _ = f.robotsRules(context.Background(), "http://127.0.0.1:1")
+	rc.mu.Lock()
+	_, ok := rc.hosts[ts.URL]
+	rc.mu.Unlock()
+	assert.False(t, ok, "expired entry not removed")
+}
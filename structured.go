@@ -0,0 +1,297 @@
+// MIT License
+//
+// Copyright (c) 2024 yulog
+
+package favicon
+
+import (
+	"encoding/json"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+
+	gq "github.com/PuerkitoBio/goquery"
+)
+
+// IgnoreStructuredData ignores logos in schema.org JSON-LD and microdata.
+var IgnoreStructuredData Option = func(f *Finder) { f.ignoreStructuredData = true }
+
+// logos in JSON-LD blocks of a page
+type jsonLD struct {
+	ids   map[string]map[string]any // nodes by @id, to resolve references
+	icons []*Icon
+}
+
+// extract logos, e.g. Organization.logo, from <script
+// type="application/ld+json"> blocks. Blocks may contain a single node,
+// an array of nodes or a @graph, and logos may be URLs, ImageObjects or
+// references to ImageObjects elsewhere on the page.
+func (p *parser) parseJSONLD(doc *gq.Document) []*Icon {
+	var (
+		ld    = &jsonLD{ids: map[string]map[string]any{}}
+		nodes []any
+	)
+	doc.Find("script").Each(func(i int, sel *gq.Selection) {
+		typ, _ := sel.Attr("type")
+		if mt, _, _ := mime.ParseMediaType(typ); mt != "application/ld+json" {
+			return
+		}
+		var v any
+		if err := json.Unmarshal([]byte(sel.Text()), &v); err != nil {
+			p.find.log.Printf("[ERROR] parse JSON-LD: %v", err)
+			return
+		}
+		ld.index(v)
+		nodes = append(nodes, v)
+	})
+
+	for _, v := range nodes {
+		ld.walk(v)
+	}
+	for _, icon := range ld.icons {
+		p.find.log.Printf("(json-ld) %s", icon.URL)
+	}
+	return ld.icons
+}
+
+// add nodes with an @id to the index
+func (ld *jsonLD) index(v any) {
+	switch v := v.(type) {
+	case []any:
+		for _, x := range v {
+			ld.index(x)
+		}
+	case map[string]any:
+		// ignore references, i.e. nodes with only an @id
+		if id, ok := v["@id"].(string); ok && len(v) > 1 {
+			ld.ids[id] = v
+		}
+		for _, x := range v {
+			ld.index(x)
+		}
+	}
+}
+
+// find logo properties in v and its children
+func (ld *jsonLD) walk(v any) {
+	switch v := v.(type) {
+	case []any:
+		for _, x := range v {
+			ld.walk(x)
+		}
+	case map[string]any:
+		// sort keys so icons are found in the same order every time
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if k == "logo" {
+				ld.addLogo(v[k], ldType(v)+".logo")
+			} else {
+				ld.walk(v[k])
+			}
+		}
+	}
+}
+
+// add the value of a logo property
+func (ld *jsonLD) addLogo(v any, rel string) {
+	var (
+		icon = &Icon{Kind: KindLogo}
+		node = v
+	)
+	switch v := v.(type) {
+	case []any:
+		for _, x := range v {
+			ld.addLogo(x, rel)
+		}
+		return
+	case string:
+		icon.URL = v
+	case map[string]any:
+		if id, ok := v["@id"].(string); ok && len(v) == 1 {
+			ref, ok := ld.ids[id]
+			if !ok {
+				return
+			}
+			v, node = ref, ref
+		}
+		icon.URL = ldString(v["contentUrl"])
+		if icon.URL == "" {
+			icon.URL = ldString(v["url"])
+		}
+		icon.Width, icon.Height = ldInt(v["width"]), ldInt(v["height"])
+		icon.Alt = ldString(v["caption"])
+		if s := ldString(v["encodingFormat"]); strings.Contains(s, "/") {
+			icon.MimeType = s
+		}
+	}
+	icon.URL = strings.TrimSpace(icon.URL)
+	if icon.URL == "" {
+		return
+	}
+	origin, _ := json.Marshal(node)
+	icon.addProvenance(Provenance{Source: SourceJSONLD, Rel: rel, Origin: string(origin)})
+	ld.icons = append(ld.icons, icon)
+}
+
+// return the schema.org type of a node, e.g. "Organization"
+func ldType(node map[string]any) string {
+	return schemaType(ldString(node["@type"]))
+}
+
+// return a string or the first string in an array
+func ldString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []any:
+		for _, x := range v {
+			if s, ok := x.(string); ok {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// return a dimension, which may be a number, a string like "600px" or a
+// QuantitativeValue
+func ldInt(v any) int {
+	switch v := v.(type) {
+	case float64:
+		if v > 0 {
+			return int(v)
+		}
+	case string:
+		return parseDimension(v)
+	case map[string]any:
+		return ldInt(v["value"])
+	}
+	return 0
+}
+
+// parse a dimension like "600" or "600px". Returns 0 if s isn't one.
+func parseDimension(s string) int {
+	s = strings.TrimSpace(strings.TrimSuffix(strings.ToLower(strings.TrimSpace(s)), "px"))
+	if n, err := strconv.ParseFloat(s, 64); err == nil && n > 0 {
+		return int(n)
+	}
+	return 0
+}
+
+// strip the vocabulary from a schema.org type, e.g.
+// "https://schema.org/Organization" or "schema:Organization"
+func schemaType(s string) string {
+	if s = strings.TrimRight(s, "/"); s == "" {
+		return ""
+	}
+	if i := strings.LastIndexAny(s, "/:"); i >= 0 {
+		s = s[i+1:]
+	}
+	return s
+}
+
+// extract logos from schema.org microdata, i.e. elements with
+// itemprop="logo". A logo is either an element with a URL, e.g. <img>,
+// or an ImageObject item.
+func (p *parser) parseMicrodata(doc *gq.Document) []*Icon {
+	var icons []*Icon
+	doc.Find("[itemprop]").Each(func(i int, sel *gq.Selection) {
+		prop, _ := sel.Attr("itemprop")
+		if !hasToken(prop, "logo") {
+			return
+		}
+
+		icon := &Icon{Kind: KindLogo}
+		if _, ok := sel.Attr("itemscope"); ok {
+			props := microdataProps(sel)
+			icon.URL = props["contentUrl"]
+			if icon.URL == "" {
+				icon.URL = props["url"]
+			}
+			icon.Width, icon.Height = parseDimension(props["width"]), parseDimension(props["height"])
+			icon.Alt = props["caption"]
+			if s := props["encodingFormat"]; strings.Contains(s, "/") {
+				icon.MimeType = s
+			}
+		} else {
+			icon.URL = microdataValue(sel)
+			if gq.NodeName(sel) == "img" {
+				w, _ := sel.Attr("width")
+				h, _ := sel.Attr("height")
+				icon.Width, icon.Height = parseDimension(w), parseDimension(h)
+				icon.Alt, _ = sel.Attr("alt")
+			}
+		}
+		if icon.URL == "" {
+			return
+		}
+
+		// type of the item the logo belongs to
+		itemtype, _ := sel.ParentsFiltered("[itemscope]").First().Attr("itemtype")
+		rel := "logo"
+		if fields := strings.Fields(itemtype); len(fields) > 0 {
+			rel = schemaType(fields[0]) + ".logo"
+		}
+		icon.addProvenance(Provenance{Source: SourceMicrodata, Rel: rel, Origin: outerHTML(sel)})
+		p.find.log.Printf("(microdata) %s", icon.URL)
+		icons = append(icons, icon)
+	})
+	return icons
+}
+
+// return the properties of a microdata item. Properties of nested items
+// are ignored.
+func microdataProps(item *gq.Selection) map[string]string {
+	props := map[string]string{}
+	item.Find("[itemprop]").Each(func(i int, sel *gq.Selection) {
+		if !sel.ParentsFiltered("[itemscope]").First().IsSelection(item) {
+			return
+		}
+		prop, _ := sel.Attr("itemprop")
+		for _, name := range strings.Fields(prop) {
+			if _, ok := props[name]; !ok {
+				props[name] = microdataValue(sel)
+			}
+		}
+	})
+	return props
+}
+
+// return the value of a microdata property
+// (https://html.spec.whatwg.org/multipage/microdata.html#values)
+func microdataValue(sel *gq.Selection) string {
+	var attr string
+	switch gq.NodeName(sel) {
+	case "meta":
+		attr = "content"
+	case "audio", "embed", "iframe", "img", "source", "track", "video":
+		attr = "src"
+	case "a", "area", "link":
+		attr = "href"
+	case "object":
+		attr = "data"
+	case "data", "meter":
+		attr = "value"
+	case "time":
+		attr = "datetime"
+	default:
+		return strings.TrimSpace(sel.Text())
+	}
+	s, _ := sel.Attr(attr)
+	return strings.TrimSpace(s)
+}
+
+// whether space-separated list s contains token
+func hasToken(s, token string) bool {
+	for _, tok := range strings.Fields(s) {
+		if tok == token {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+// MIT License
+//
+// Copyright (c) 2024 yulog
+
+package favicon
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestStructuredData verifies logos in JSON-LD and microdata.
+func TestStructuredData(t *testing.T) {
+	t.Parallel()
+	type logo struct {
+		url    string
+		w, h   int
+		source Source
+		rel    string
+	}
+	tests := []struct {
+		name string
+		html string
+		x    []logo
+	}{
+		{"json-ld url", `<script type="application/ld+json">
+{"@context": "https://schema.org", "@type": "Organization", "logo": "https://example.com/logo.png"}
+</script>`, []logo{{"https://example.com/logo.png", 0, 0, SourceJSONLD, "Organization.logo"}}},
+		{"json-ld publisher", `<script type="application/ld+json">
+{"@context": "https://schema.org", "@type": "NewsArticle", "image": "https://example.com/photo.jpg",
+ "publisher": {"@type": "NewsMediaOrganization", "name": "News",
+  "logo": {"@type": "ImageObject", "url": "https://example.com/news.png", "width": 600, "height": "60px"}}}
+</script>`, []logo{{"https://example.com/news.png", 600, 60, SourceJSONLD, "NewsMediaOrganization.logo"}}},
+		{"json-ld graph", `<script type="application/ld+json; charset=utf-8">
+{"@context": "https://schema.org", "@graph": [
+  {"@type": "WebSite", "@id": "https://example.com/#website", "publisher": {"@id": "https://example.com/#org"}},
+  {"@type": "Organization", "@id": "https://example.com/#org", "logo": {"@id": "https://example.com/#logo"}},
+  {"@type": "ImageObject", "@id": "https://example.com/#logo", "contentUrl": "https://example.com/org.png",
+   "width": {"@type": "QuantitativeValue", "value": 512}, "height": 512}
+]}
+</script>`, []logo{{"https://example.com/org.png", 512, 512, SourceJSONLD, "Organization.logo"}}},
+		{"json-ld array", `<script type="application/ld+json">
+[{"@type": "Brand", "logo": ["/a.png", {"url": "/b.svg"}]}, {"@type": "Person", "name": "x"}]
+</script>
+<script type="application/ld+json">{invalid</script>`, []logo{
+			{"/a.png", 0, 0, SourceJSONLD, "Brand.logo"},
+			{"/b.svg", 0, 0, SourceJSONLD, "Brand.logo"},
+		}},
+		{"microdata img", `<div itemscope itemtype="https://schema.org/Organization">
+<a itemprop="url" href="/">Home</a>
+<img itemprop="logo" src="/logo.png" width="200" height="100" alt="Logo">
+</div>`, []logo{{"/logo.png", 200, 100, SourceMicrodata, "Organization.logo"}}},
+		{"microdata item", `<div itemscope itemtype="https://schema.org/Organization">
+<a itemprop="url" href="/">Home</a>
+<div itemprop="logo" itemscope itemtype="https://schema.org/ImageObject">
+  <link itemprop="url" href="/logo.png">
+  <meta itemprop="width" content="300">
+  <meta itemprop="height" content="300">
+  <div itemprop="thumbnail" itemscope itemtype="https://schema.org/ImageObject">
+    <link itemprop="url" href="/thumb.png">
+  </div>
+</div>
+</div>`, []logo{{"/logo.png", 300, 300, SourceMicrodata, "Organization.logo"}}},
+		{"none", `<script type="application/ld+json">{"@type": "Organization", "name": "x"}</script>
+<img itemprop="image" src="/photo.jpg">`, nil},
+	}
+
+	for _, td := range tests {
+		td := td
+		t.Run(td.name, func(t *testing.T) {
+			t.Parallel()
+			f := New(IgnoreWellKnown, IgnoreManifest, IgnoreBrowserConfig)
+			res, err := f.newParser().parseReader(context.Background(), strings.NewReader(`<html><body>`+td.html+`</body></html>`))
+			require.Nil(t, err, "unexpected error")
+
+			var logos []logo
+			for _, icon := range res.Icons {
+				assert.Equal(t, KindLogo, icon.Kind, "unexpected kind")
+				logos = append(logos, logo{icon.URL, icon.Width, icon.Height, icon.Source, icon.Rel})
+			}
+			assert.ElementsMatch(t, td.x, logos, "unexpected logos")
+
+			n := 0
+			for _, l := range td.x {
+				if l.source == SourceJSONLD {
+					n++
+				}
+			}
+			assert.Equal(t, n, res.Report(SourceJSONLD).Count, "unexpected JSON-LD count")
+			assert.Equal(t, len(td.x)-n, res.Report(SourceMicrodata).Count, "unexpected microdata count")
+		})
+	}
+
+	t.Run("ignore", func(t *testing.T) {
+		t.Parallel()
+		f := New(IgnoreWellKnown, IgnoreManifest, IgnoreBrowserConfig, IgnoreStructuredData)
+		res, err := f.newParser().parseReader(context.Background(), strings.NewReader(
+			`<html><body><img itemprop="logo" src="/logo.png"></body></html>`))
+		require.Nil(t, err, "unexpected error")
+		assert.Equal(t, 0, len(res.Icons), "unexpected icons")
+		assert.Nil(t, res.Report(SourceMicrodata), "unexpected microdata report")
+	})
+}
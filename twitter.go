@@ -4,38 +4,65 @@
 
 package favicon
 
-import "strconv"
+// Twitter card types. See Icon.TwitterCard.
+const (
+	// Card with a small, square image, usually the site's logo.
+	TwitterCardSummary = "summary"
+	// Card with a large, wide image, usually a banner or photo.
+	TwitterCardSummaryLargeImage = "summary_large_image"
+)
 
-func (p *parser) parseTwitter(kv []string) []*Icon {
+// parse twitter:image tags and return the icons and the value of
+// twitter:card, if any
+func (p *parser) parseTwitter(tags []metaTag) ([]*Icon, string) {
 	var (
 		icons []*Icon
-		icon  *Icon
+		card  string
+		image []metaTag
 	)
-	for i := 0; i < len(kv)-1; i += 2 {
-		k, v := kv[i], kv[i+1]
-		switch k {
-		case "twitter:image:src", "twitter:image":
-			if icon != nil {
-				icons = append(icons, icon)
-			}
-			icon = &Icon{URL: v}
-			p.find.log.Printf("(twitter) %s", icon.URL)
-		case "twitter:image:width":
-			if icon != nil {
-				if n, err := strconv.ParseInt(v, 10, 32); err == nil {
-					icon.Width = int(n)
-				}
-			}
-		case "twitter:image:height":
-			if icon != nil {
-				if n, err := strconv.ParseInt(v, 10, 32); err == nil {
-					icon.Height = int(n)
-				}
+	for _, tag := range tags {
+		if tag.prop == "twitter:card" {
+			if card == "" {
+				card = tag.val
 			}
+			continue
 		}
+		image = append(image, tag)
 	}
-	if icon != nil {
+
+	for _, g := range groupMetaTags(image, "twitter:image", "twitter:image:src") {
+		tag, ok := g["url"]
+		if !ok {
+			continue
+		}
+		icon := &Icon{
+			URL:         tag.val,
+			Width:       g.int("width"),
+			Height:      g.int("height"),
+			Alt:         g["alt"].val,
+			TwitterCard: card,
+			Kind:        KindSocialImage,
+		}
+		icon.addProvenance(Provenance{Source: SourceTwitter, Rel: tag.prop, Origin: tag.origin})
+		p.find.log.Printf("(twitter) %s", icon.URL)
 		icons = append(icons, icon)
 	}
-	return icons
+	return icons, card
+}
+
+// set MIME types of Twitter images that are also Open Graph images from
+// their og:image:type. Twitter has no property for the type, so images
+// whose URL has no extension would otherwise be ignored.
+func (p *parser) inheritMimeTypes(tw, og []*Icon) {
+	types := map[string]string{}
+	for _, icon := range og {
+		if icon.MimeType != "" {
+			types[p.absURL(icon.URL)] = icon.MimeType
+		}
+	}
+	for _, icon := range tw {
+		if icon.MimeType == "" {
+			icon.MimeType = types[p.absURL(icon.URL)]
+		}
+	}
 }
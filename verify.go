@@ -0,0 +1,156 @@
+// MIT License
+//
+// Copyright (c) 2024 yulog
+
+package favicon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// number of bytes read to determine an icon's format and size. Enough for
+// image headers and JPEGs with typical EXIF data.
+const verifyReadSize = 256 << 10
+
+// Verification compares an Icon's declared format and size, i.e. those
+// read from markup, manifest or URL, with the real ones read from its data.
+type Verification struct {
+	DeclaredMimeType string `json:"declared_mimetype"`
+	DeclaredWidth    int    `json:"declared_width"`
+	DeclaredHeight   int    `json:"declared_height"`
+	// Format and size read from the icon's data. Empty if verification
+	// failed.
+	MimeType string `json:"mimetype,omitempty"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	// Error retrieving icon or reading its data. Encoded as its message
+	// in JSON.
+	Err error `json:"-"`
+}
+
+// OK returns true if the icon was retrieved and its format recognised.
+func (v *Verification) OK() bool { return v.Err == nil }
+
+// MarshalJSON implements json.Marshaler.
+func (v *Verification) MarshalJSON() ([]byte, error) {
+	type verification Verification
+	return json.Marshal(struct {
+		*verification
+		Error string `json:"error,omitempty"`
+	}{(*verification)(v), errorString(v.Err)})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (v *Verification) UnmarshalJSON(data []byte) error {
+	type verification Verification
+	x := struct {
+		*verification
+		Error string `json:"error,omitempty"`
+	}{verification: (*verification)(v)}
+	if err := json.Unmarshal(data, &x); err != nil {
+		return err
+	}
+	v.Err = stringError(x.Error)
+	return nil
+}
+
+// Matches returns true if the icon's real format and size are the declared ones.
+func (v *Verification) Matches() bool {
+	return v.OK() && sameMimeType(v.DeclaredMimeType, v.MimeType) &&
+		v.DeclaredWidth == v.Width && v.DeclaredHeight == v.Height
+}
+
+// WithVerify configures Finder to download icons to check their real format
+// and size. Icons' MimeType, Width and Height are corrected before filtering
+// and sorting, and the declared values are kept in Icon.Verification.
+func WithVerify() Option {
+	return func(f *Finder) {
+		f.verify = true
+	}
+}
+
+// Verify downloads icons to check their real format and size. Icons whose
+// format is recognised have their MimeType, Width, Height and Hash updated.
+// Each Icon's Verification field is set, including any error encountered.
+// Icons with the same URL are only downloaded once. It returns an error only
+// if ctx is cancelled.
+func (f *Finder) Verify(ctx context.Context, icons []*Icon) error {
+	f.verifyIcons(ctx, icons)
+	for _, icon := range icons {
+		if icon.MimeType != "" {
+			icon.Hash = iconHash(icon)
+		}
+	}
+	return ctx.Err()
+}
+
+func (f *Finder) verifyIcons(ctx context.Context, icons []*Icon) {
+	var (
+		urls  []string
+		byURL = map[string][]*Icon{}
+	)
+	for _, icon := range icons {
+		if _, ok := byURL[icon.URL]; !ok {
+			urls = append(urls, icon.URL)
+		}
+		byURL[icon.URL] = append(byURL[icon.URL], icon)
+	}
+
+	f.parallel(len(urls), func(i int) {
+		info, err := f.readImageInfo(ctx, urls[i])
+		for _, icon := range byURL[urls[i]] {
+			verifyIcon(icon, info, err)
+		}
+	})
+}
+
+// retrieve start of image at URL and determine its format and size
+func (f *Finder) readImageInfo(ctx context.Context, url string) (imageInfo, error) {
+	rc, err := f.fetchURL(ctx, url)
+	if err != nil {
+		return imageInfo{}, err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, verifyReadSize))
+	if err != nil {
+		return imageInfo{}, fmt.Errorf("read icon: %w", err)
+	}
+	info, err := readImageInfo(data)
+	if err != nil {
+		return imageInfo{}, fmt.Errorf("read icon: %w", err)
+	}
+	f.log.Printf("(verify) %s: %s %dx%d", url, info.mimeType, info.width, info.height)
+	return info, nil
+}
+
+// update icon with real format & size
+func verifyIcon(icon *Icon, info imageInfo, err error) {
+	v := &Verification{
+		DeclaredMimeType: icon.MimeType,
+		DeclaredWidth:    icon.Width,
+		DeclaredHeight:   icon.Height,
+		Err:              err,
+	}
+	icon.Verification = v
+	if err != nil {
+		return
+	}
+
+	v.MimeType, v.Width, v.Height = info.mimeType, info.width, info.height
+	// multi-image files, e.g. ICO, may contain the declared size
+	if icon.Width != 0 && info.hasSize(icon.Width, icon.Height) {
+		v.Width, v.Height = icon.Width, icon.Height
+	}
+
+	if !sameMimeType(icon.MimeType, v.MimeType) {
+		icon.MimeType = v.MimeType
+	}
+	icon.Width, icon.Height = v.Width, v.Height
+	if sameMimeType(v.MimeType, mimeSVG) {
+		icon.Scalable = true
+	}
+}
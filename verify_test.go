@@ -0,0 +1,172 @@
+// MIT License
+//
+// Copyright (c) 2024 yulog
+
+package favicon
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// encode a blank image of the given size
+func encodeImage(t *testing.T, format string, w, h int) []byte {
+	var (
+		buf bytes.Buffer
+		img = image.NewRGBA(image.Rect(0, 0, w, h))
+		err error
+	)
+	switch format {
+	case "png":
+		err = png.Encode(&buf, img)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, nil)
+	}
+	require.Nil(t, err, "encode image")
+	return buf.Bytes()
+}
+
+// TestReadImageInfo verifies detection of image formats and sizes.
+func TestReadImageInfo(t *testing.T) {
+	t.Parallel()
+	ico, err := os.ReadFile("testdata/multisize/favicon.ico")
+	require.Nil(t, err, "unexpected error")
+
+	tests := []struct {
+		name          string
+		data          []byte
+		mimeType      string
+		width, height int
+	}{
+		{"png", encodeImage(t, "png", 32, 16), "image/png", 32, 16},
+		{"gif", encodeImage(t, "gif", 20, 10), "image/gif", 20, 10},
+		{"jpeg", encodeImage(t, "jpeg", 64, 48), "image/jpeg", 64, 48},
+		{"ico", ico, "image/x-icon", 48, 48},
+		{"bmp", append([]byte("BM"+
+			"\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"+ // rest of file header
+			"\x28\x00\x00\x00"+ // BITMAPINFOHEADER
+			"\x18\x00\x00\x00"+ // width 24
+			"\xf0\xff\xff\xff"), // height -16 (top-down)
+			make([]byte, 16)...), "image/bmp", 24, 16},
+		{"webp-lossy", []byte("RIFF\x00\x00\x00\x00WEBPVP8 \x00\x00\x00\x00" +
+			"\x00\x00\x00\x9d\x01\x2a" + // frame tag & start code
+			"\x40\x00\x20\x00"), "image/webp", 64, 32},
+		{"webp-lossless", []byte("RIFF\x00\x00\x00\x00WEBPVP8L\x00\x00\x00\x00" +
+			"\x2f\x3f\xc0\x0f\x00\x00\x00\x00\x00\x00"), "image/webp", 64, 64},
+		{"webp-extended", []byte("RIFF\x00\x00\x00\x00WEBPVP8X\x0a\x00\x00\x00" +
+			"\x00\x00\x00\x00" + // flags
+			"\xff\x01\x00" + // width-1 = 511
+			"\x7f\x00\x00"), "image/webp", 512, 128},
+		{"svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg" width="48px" height="24"/>`), "image/svg+xml", 48, 24},
+		{"svg-viewbox", []byte("\xef\xbb\xbf<?xml version=\"1.0\"?>\n<!-- logo -->\n" +
+			`<svg xmlns="http://www.w3.org/2000/svg" width="100%" viewBox="0,0 32 16"></svg>`), "image/svg+xml", 32, 16},
+		{"svg-nosize", []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`), "image/svg+xml", 0, 0},
+	}
+
+	for _, td := range tests {
+		td := td
+		t.Run(td.name, func(t *testing.T) {
+			t.Parallel()
+			info, err := readImageInfo(td.data)
+			require.Nil(t, err, "unexpected error")
+			assert.Equal(t, td.mimeType, info.mimeType, "unexpected MIME type")
+			assert.Equal(t, td.width, info.width, "unexpected width")
+			assert.Equal(t, td.height, info.height, "unexpected height")
+		})
+	}
+
+	_, err = readImageInfo([]byte("<!DOCTYPE html>"))
+	assert.Equal(t, errUnknownFormat, err, "unexpected error")
+	_, err = readImageInfo([]byte(`<?xml version="1.0"?><html></html>`))
+	assert.Equal(t, errUnknownFormat, err, "unexpected error")
+}
+
+// TestVerify verifies that icons' real sizes replace declared ones.
+func TestVerify(t *testing.T) {
+	t.Parallel()
+	var (
+		page = []byte(`<html><head>
+<link rel="icon" href="/icon.png" sizes="16x16">
+<link rel="icon" href="/icon-64x64.png">
+<link rel="icon" href="/favicon.ico" sizes="48x48 24x24 16x16">
+<link rel="icon" href="/image">
+<link rel="icon" href="/missing.png" sizes="32x32">
+</head></html>`)
+		icon32 = encodeImage(t, "png", 32, 32)
+		jpeg64 = encodeImage(t, "jpeg", 64, 64)
+	)
+	ico, err := os.ReadFile("testdata/multisize/favicon.ico")
+	require.Nil(t, err, "unexpected error")
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			_, _ = w.Write(page)
+		case "/icon.png":
+			_, _ = w.Write(icon32)
+		case "/icon-64x64.png", "/image":
+			_, _ = w.Write(jpeg64)
+		case "/favicon.ico":
+			_, _ = w.Write(ico)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	f := New(WithClient(ts.Client()), WithLogger(debugLogger{}), IgnoreManifest, IgnoreWellKnown, WithVerify())
+	icons, err := f.Find(ts.URL + "/")
+	require.Nil(t, err, "unexpected error")
+
+	found := map[string][]*Icon{}
+	for _, icon := range icons {
+		require.NotNil(t, icon.Verification, "icon not verified")
+		found[icon.URL] = append(found[icon.URL], icon)
+	}
+	require.Equal(t, 5, len(found), "unexpected favicon count")
+
+	icon := found[ts.URL+"/icon.png"][0]
+	assert.Equal(t, 32, icon.Width, "unexpected width")
+	assert.Equal(t, 16, icon.Verification.DeclaredWidth, "unexpected declared width")
+	assert.False(t, icon.Verification.Matches(), "unexpected match")
+
+	icon = found[ts.URL+"/icon-64x64.png"][0]
+	assert.Equal(t, "image/jpeg", icon.MimeType, "unexpected MIME type")
+	assert.Equal(t, "image/png", icon.Verification.DeclaredMimeType, "unexpected declared MIME type")
+
+	// MIME type determined from data
+	icon = found[ts.URL+"/image"][0]
+	assert.Equal(t, "image/jpeg", icon.MimeType, "unexpected MIME type")
+	assert.Equal(t, 64, icon.Height, "unexpected height")
+
+	// ICO file contains 48x48 and 16x16, but not 24x24, which is
+	// corrected to the largest size and merged with 48x48
+	require.Equal(t, 2, len(found[ts.URL+"/favicon.ico"]), "unexpected ICO count")
+	for _, icon := range found[ts.URL+"/favicon.ico"] {
+		assert.True(t, icon.Width == 48 || icon.Width == 16, "unexpected width: %d", icon.Width)
+	}
+
+	// missing icons are kept, but marked as failed
+	icon = found[ts.URL+"/missing.png"][0]
+	assert.False(t, icon.Verification.OK(), "unexpected success")
+	assert.Equal(t, 32, icon.Width, "unexpected width")
+
+	// Verify can be called directly
+	icon = &Icon{URL: ts.URL + "/icon.png", MimeType: "image/png", Width: 16, Height: 16}
+	require.Nil(t, New(WithClient(ts.Client())).Verify(context.Background(), []*Icon{icon}), "unexpected error")
+	assert.Equal(t, 32, icon.Width, "unexpected width")
+	assert.Equal(t, iconHash(icon), icon.Hash, "hash not updated")
+}
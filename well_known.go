@@ -4,32 +4,122 @@
 
 package favicon
 
-// IconNames are common names of icon files hosted in server roots.
-var IconNames = []string{
-	"favicon.ico",
-	"apple-touch-icon.png",
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// IconNames are common names of icon files hosted in server roots. They are
+// the paths probed by Finders created without WithWellKnownPaths. Sizes are
+// inferred from names like apple-touch-icon-180x180.png.
+//
+// Deprecated: IconNames is shared by all Finders, and changing it while
+// they are searching is racy. Use WithWellKnownPaths instead.
+var IconNames = DefaultWellKnownPaths()
+
+// DefaultWellKnownPaths returns the paths probed by default: the common
+// favicon names and the Apple touch icon names requested by iOS.
+func DefaultWellKnownPaths() []string {
+	return []string{
+		"favicon.ico",
+		"favicon.svg",
+		"favicon.png",
+		"apple-touch-icon.png",
+		"apple-touch-icon-precomposed.png",
+		"apple-touch-icon-120x120.png",
+		"apple-touch-icon-152x152.png",
+		"apple-touch-icon-167x167.png",
+		"apple-touch-icon-180x180.png",
+	}
 }
 
-func (p *parser) findWellKnownIcons() []*Icon {
+// WithWellKnownPaths sets the paths Finder probes for icons, replacing the
+// defaults. Relative paths, e.g. "favicon.ico", are resolved against the
+// server root (and the page's directory if WellKnownInPageDir is set);
+// absolute paths, e.g. "/static/icon.png", only against the server root.
+// Sizes are inferred from names like icon-32x32.png.
+func WithWellKnownPaths(paths ...string) Option {
+	return func(f *Finder) {
+		f.wellKnownPaths = append([]string{}, paths...)
+	}
+}
+
+// WellKnownInPageDir also probes well-known paths in the directory of the
+// searched page, e.g. /blog/favicon.ico for https://example.com/blog/post.
+var WellKnownInPageDir Option = func(f *Finder) { f.wellKnownInPageDir = true }
+
+// return URLs of well-known paths in the server root and, if configured,
+// the page's directory
+func (p *parser) wellKnownURLs() []string {
 	if p.baseURL == nil {
 		return nil
 	}
 
+	paths := p.find.wellKnownPaths
+	if paths == nil {
+		paths = IconNames
+	}
+
 	var (
-		icons []*Icon
-		root  = p.baseURL.Scheme + "://" + p.baseURL.Host + "/"
+		root = p.baseURL.Scheme + "://" + p.baseURL.Host
+		dirs = []string{"/"}
+		seen = map[string]bool{}
+		urls []string
 	)
-	for _, name := range IconNames {
-		u := root + name
-		r, err := p.find.fetchURL(u)
-		if err != nil {
-			continue
+	if p.find.wellKnownInPageDir {
+		if dir := path.Dir(p.baseURL.Path + "x"); dir != "/" && dir != "." {
+			dirs = append(dirs, dir+"/")
 		}
-		r.Close()
+	}
+	for _, dir := range dirs {
+		for _, name := range paths {
+			u := root + path.Join(dir, name)
+			if strings.HasPrefix(name, "/") {
+				u = root + name
+			}
+			if !seen[u] {
+				seen[u] = true
+				urls = append(urls, u)
+			}
+		}
+	}
+	return urls
+}
 
-		p.find.log.Printf("(well-known) %s", u)
-		icons = append(icons, &Icon{URL: u})
+// check whether an image exists at URL
+func (p *parser) findWellKnownIcon(ctx context.Context, u string) ([]*Icon, error) {
+	resp, err := p.find.fetch(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	head := make([]byte, sniffSize)
+	n, err := io.ReadFull(resp.Body, head)
+	resp.Body.Close()
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, ErrEmptyIcon
+	}
+	// SPAs and soft-404 pages answer every path with 200 and HTML.
+	// Trust the Content-Type for images the data aren't recognised as,
+	// e.g. SVGs with a long prolog.
+	ct := sniffContentType(head[:n])
+	if !strings.HasPrefix(ct, "image/") {
+		typ := resp.Header.Get("Content-Type")
+		if strings.HasPrefix(ct, "text/html") || !strings.HasPrefix(typ, "image/") {
+			return nil, fmt.Errorf("%w: %s", ErrNotImage, ct)
+		}
 	}
 
-	return icons
+	p.find.log.Printf("(well-known) %s", u)
+	icon := &Icon{URL: u, Kind: wellKnownKind(u)}
+	if sz := extractSizeFromURL(u); sz != nil {
+		icon.Width, icon.Height = sz.w, sz.h
+	}
+	icon.addProvenance(Provenance{Source: SourceWellKnown, Origin: u})
+	return []*Icon{icon}, nil
 }
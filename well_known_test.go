@@ -0,0 +1,111 @@
+// MIT License
+//
+// Copyright (c) 2024 yulog
+
+package favicon
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestWellKnownPaths verifies default and custom well-known paths.
+func TestWellKnownPaths(t *testing.T) {
+	t.Parallel()
+	var (
+		mu        sync.Mutex
+		requested []string
+		png       = encodeImage(t, "png", 16, 16)
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested = append(requested, r.URL.Path)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/blog/post":
+			_, _ = w.Write([]byte(`<html></html>`))
+		case "/favicon.svg":
+			_, _ = w.Write([]byte(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 16 16"></svg>`))
+		case "/apple-touch-icon-152x152.png", "/blog/favicon.ico", "/static/logo.png":
+			_, _ = w.Write(png)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	reset := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		v := requested
+		requested = nil
+		sort.Strings(v)
+		return v
+	}
+
+	// defaults
+	f := New(WithClient(ts.Client()), WithLogger(debugLogger{}), IgnoreManifest, IgnoreBrowserConfig)
+	icons, err := f.Find(ts.URL + "/blog/post")
+	require.Nil(t, err, "unexpected error")
+	require.Equal(t, 2, len(icons), "unexpected favicon count")
+	assert.Equal(t, ts.URL+"/favicon.svg", icons[0].URL, "unexpected icon")
+	assert.True(t, icons[0].Scalable, "SVG not scalable")
+	assert.Equal(t, ts.URL+"/apple-touch-icon-152x152.png", icons[1].URL, "unexpected icon")
+	assert.Equal(t, 152, icons[1].Width, "size not inferred")
+	assert.Equal(t, len(DefaultWellKnownPaths())+1, len(reset()), "unexpected request count")
+
+	// custom paths in root and page directory
+	f = New(WithClient(ts.Client()), WithLogger(debugLogger{}), IgnoreManifest, IgnoreBrowserConfig,
+		WithWellKnownPaths("favicon.ico", "/static/logo.png"), WellKnownInPageDir)
+	icons, err = f.Find(ts.URL + "/blog/post")
+	require.Nil(t, err, "unexpected error")
+	urls := []string{}
+	for _, icon := range icons {
+		urls = append(urls, icon.URL)
+	}
+	assert.ElementsMatch(t, []string{ts.URL + "/blog/favicon.ico", ts.URL + "/static/logo.png"}, urls, "unexpected icons")
+	assert.Equal(t, []string{"/blog/favicon.ico", "/blog/post", "/favicon.ico", "/static/logo.png"}, reset(), "unexpected requests")
+
+	// other Finders are unaffected
+	assert.Equal(t, DefaultWellKnownPaths(), IconNames, "IconNames modified")
+}
+
+// TestWellKnownSoft404 verifies that HTML served for every path, e.g. by
+// SPAs, isn't mistaken for well-known icons.
+func TestWellKnownSoft404(t *testing.T) {
+	t.Parallel()
+	png := encodeImage(t, "png", 16, 16)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/favicon.ico":
+			_, _ = w.Write(png)
+		default:
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = w.Write([]byte(`<!DOCTYPE html><html><head><link rel="icon" href="/icon.png"></head></html>`))
+		}
+	}))
+	defer ts.Close()
+
+	f := New(WithClient(ts.Client()), WithLogger(debugLogger{}), IgnoreManifest, IgnoreBrowserConfig)
+	res, err := f.FindDetailed(ts.URL + "/")
+	require.Nil(t, err, "unexpected error")
+	var urls []string
+	for _, icon := range res.Icons {
+		urls = append(urls, icon.URL)
+	}
+	assert.ElementsMatch(t, []string{ts.URL + "/favicon.ico", ts.URL + "/icon.png"}, urls, "unexpected icons")
+
+	for _, sr := range res.Reports {
+		if sr.Source != SourceWellKnown || sr.URL == ts.URL+"/favicon.ico" {
+			continue
+		}
+		assert.Equal(t, 0, sr.Count, "unexpected count: %s", sr.URL)
+		assert.True(t, errors.Is(sr.Err, ErrNotImage), "unexpected error: %v", sr.Err)
+	}
+}